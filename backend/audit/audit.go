@@ -0,0 +1,376 @@
+// Package audit records security and admin actions in a hash-chained,
+// append-only log.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Actions
+const (
+	ActionRegister             = "auth.register"
+	ActionLogin                = "auth.login"
+	ActionLoginFailed          = "auth.login_failed"
+	ActionLogout               = "auth.logout"
+	ActionPasswordReset        = "auth.password_reset"
+	ActionUserCreate           = "user.create"
+	ActionUserUpdate           = "user.update"
+	ActionUserDelete           = "user.delete"
+	ActionUserRestore          = "user.restore"
+	ActionUserPurge            = "user.purge"
+	ActionUserStatus           = "user.status_change"
+	ActionUserRevoke           = "user.revoke_tokens"
+	ActionUserMFAReset         = "user.mfa_reset"
+	ActionMFADisable           = "user.mfa_disable" // by the user, see ActionUserMFAReset for admins
+	ActionImpersonate          = "user.impersonate"
+	ActionImpersonated         = "impersonation.request" // any request made with an impersonation token
+	ActionTokenCreate          = "token.create"
+	ActionTokenRevoke          = "token.revoke"
+	ActionServiceAccountCreate = "service_account.create"
+	ActionServiceAccountUpdate = "service_account.update"
+	ActionServiceAccountDelete = "service_account.delete"
+	ActionServiceAccountRotate = "service_account.secret_rotate"
+	ActionServiceAccountRevoke = "service_account.secret_revoke"
+	ActionServiceAccountToken  = "service_account.token"
+	ActionServiceAccountFailed = "service_account.token_failed"
+	ActionInviteCreate         = "invitation.create"
+	ActionInviteRevoke         = "invitation.revoke"
+	ActionRoleCreate           = "role.create"
+	ActionRoleUpdate           = "role.update"
+	ActionRoleDelete           = "role.delete"
+	ActionRoleGrant            = "role.grant"
+	ActionRoleRevoke           = "role.revoke"
+	ActionPermCreate           = "permission.create"
+	ActionPermUpdate           = "permission.update"
+	ActionPermDelete           = "permission.delete"
+	ActionLockoutClear         = "lockout.clear"
+)
+
+// Outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Target types
+const (
+	TargetUser           = "user"
+	TargetRole           = "role"
+	TargetPermission     = "permission"
+	TargetInvitation     = "invitation"
+	TargetLockout        = "lockout"
+	TargetToken          = "personal_access_token"
+	TargetServiceAccount = "service_account"
+)
+
+const redactedValue = "[redacted]"
+
+// chainLockKey - pg_advisory_xact_lock key serializing appends to the chain
+const chainLockKey int64 = 0x61756469
+
+// sensitiveKeys - Values of keys containing one of these are never stored
+var sensitiveKeys = []string{"password", "secret", "token", "recovery_code"}
+
+// Event - One action to record. Before and After are snapshots of the target
+// (structs or maps), only fields that differ end up in the log.
+type Event struct {
+	Action     string
+	Outcome    string // default success
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+	Metadata   map[string]interface{}
+
+	// Actor, taken from the request when empty (AuthMiddleware). While
+	// impersonating, the actor is the impersonated user and ImpersonatorID
+	// the admin holding the token. Requests of service accounts have no
+	// user, only ServiceAccountID.
+	ActorID          uint
+	ActorEmail       string
+	ImpersonatorID   uint
+	ServiceAccountID uint
+}
+
+// Record - Write an event for the current request. Failures are logged and do
+// not fail the request.
+func Record(c *gin.Context, event Event) {
+	if err := RecordTx(c, config.DB, event); err != nil {
+		log.Printf("Failed to write audit event %s: %v", event.Action, err)
+	}
+}
+
+// RecordTx - Write an event for the current request within the caller's
+// transaction, so that it is kept only together with the change it records
+func RecordTx(c *gin.Context, tx *gorm.DB, event Event) error {
+	if event.ActorID == 0 {
+		event.ActorID = c.GetUint("userID")
+	}
+	if event.ActorEmail == "" {
+		event.ActorEmail = c.GetString("userEmail")
+	}
+	if event.ImpersonatorID == 0 {
+		event.ImpersonatorID = c.GetUint("impersonatorID")
+	}
+	if event.ServiceAccountID == 0 {
+		event.ServiceAccountID = c.GetUint("serviceAccountID")
+	}
+
+	_, err := WriteTx(tx, event, RequestInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString("requestID"),
+	})
+	return err
+}
+
+// InTx - Record the event built by event when a service calls the returned
+// function with its transaction
+func InTx(c *gin.Context, event func() Event) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return RecordTx(c, tx, event())
+	}
+}
+
+// RequestInfo - Where an event came from
+type RequestInfo struct {
+	IPAddress string
+	UserAgent string
+	RequestID string
+}
+
+// Write - Append an event to the chain
+func Write(event Event, info RequestInfo) (*models.AuditEvent, error) {
+	return WriteTx(config.DB, event, info)
+}
+
+// WriteTx - Write within db, which may be a transaction of the caller
+func WriteTx(db *gorm.DB, event Event, info RequestInfo) (*models.AuditEvent, error) {
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+
+	record := models.AuditEvent{
+		// Postgres keeps microseconds, the hash must survive the round trip
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		ActorEmail: event.ActorEmail,
+		Action:     event.Action,
+		Outcome:    event.Outcome,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IPAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		RequestID:  info.RequestID,
+	}
+	if event.ActorID != 0 {
+		actorID := event.ActorID
+		record.ActorID = &actorID
+	}
+	if event.ImpersonatorID != 0 {
+		impersonatorID := event.ImpersonatorID
+		record.ImpersonatorID = &impersonatorID
+	}
+	if event.ServiceAccountID != 0 {
+		serviceAccountID := event.ServiceAccountID
+		record.ServiceAccountID = &serviceAccountID
+	}
+
+	var err error
+	if record.Changes, err = marshalNonEmpty(Diff(event.Before, event.After)); err != nil {
+		return nil, err
+	}
+	if record.Metadata, err = marshalNonEmpty(redact(event.Metadata)); err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockKey).Error; err != nil {
+			return err
+		}
+
+		var last models.AuditEvent
+		err := tx.Select("hash").Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+
+		record.PrevHash = last.Hash
+		record.Hash, err = hashEvent(&record)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Diff - Fields of before and after (JSON representation) that differ, as
+// field -> {"from", "to"}. Without before every field of after is included.
+func Diff(before, after interface{}) map[string]interface{} {
+	from := toMap(before)
+	to := toMap(after)
+	if from == nil && to == nil {
+		return nil
+	}
+
+	keys := make(map[string]bool)
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	changes := make(map[string]interface{})
+	for key := range keys {
+		oldValue, hadOld := from[key]
+		newValue, hasNew := to[key]
+		if hadOld && hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		change := map[string]interface{}{}
+		if hadOld {
+			change["from"] = oldValue
+		}
+		if hasNew {
+			change["to"] = newValue
+		}
+		if isSensitive(key) {
+			change = map[string]interface{}{"changed": true}
+		}
+		changes[key] = change
+	}
+	return changes
+}
+
+// toMap - JSON object representation of a snapshot
+func toMap(value interface{}) map[string]interface{} {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+func redact(metadata map[string]interface{}) map[string]interface{} {
+	if len(metadata) == 0 {
+		return nil
+	}
+	clean := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		if isSensitive(key) {
+			value = redactedValue
+		}
+		clean[key] = value
+	}
+	return clean
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func marshalNonEmpty(m map[string]interface{}) (json.RawMessage, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalJSON(data)
+}
+
+// Filter - Audit log query
+type Filter struct {
+	ActorID          *uint
+	ImpersonatorID   *uint
+	ServiceAccountID *uint
+	Action           string // exact, or prefix when ending in "*" (e.g. "user.*")
+	Outcome          string
+	TargetType       string
+	TargetID         string
+	RequestID        string
+	From             *time.Time
+	To               *time.Time // exclusive
+	Page             int
+	Limit            int
+}
+
+// Query - Matching events, newest first, and the total count
+func Query(f Filter) ([]models.AuditEvent, int64, error) {
+	db := config.DB.Model(&models.AuditEvent{})
+	if f.ActorID != nil {
+		db = db.Where("actor_id = ?", *f.ActorID)
+	}
+	if f.ImpersonatorID != nil {
+		db = db.Where("impersonator_id = ?", *f.ImpersonatorID)
+	}
+	if f.ServiceAccountID != nil {
+		db = db.Where("service_account_id = ?", *f.ServiceAccountID)
+	}
+	if strings.HasSuffix(f.Action, "*") {
+		prefix := strings.TrimSuffix(f.Action, "*")
+		db = db.Where("action LIKE ?", strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)+"%")
+	} else if f.Action != "" {
+		db = db.Where("action = ?", f.Action)
+	}
+	if f.Outcome != "" {
+		db = db.Where("outcome = ?", f.Outcome)
+	}
+	if f.TargetType != "" {
+		db = db.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		db = db.Where("target_id = ?", f.TargetID)
+	}
+	if f.RequestID != "" {
+		db = db.Where("request_id = ?", f.RequestID)
+	}
+	if f.From != nil {
+		db = db.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("created_at < ?", *f.To)
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AuditEvent
+	err := db.Session(&gorm.Session{}).
+		Order("id DESC").
+		Offset((f.Page - 1) * f.Limit).
+		Limit(f.Limit).
+		Find(&events).Error
+	return events, total, err
+}
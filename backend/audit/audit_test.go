@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type snapshot struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   map[string]interface{}
+	}{
+		{name: "no snapshots", want: nil},
+		{name: "nil pointer", before: (*snapshot)(nil), want: nil},
+		{
+			name:   "unchanged fields are left out",
+			before: snapshot{Name: "Jane", Email: "jane@example.com"},
+			after:  snapshot{Name: "Joan", Email: "jane@example.com"},
+			want:   map[string]interface{}{"name": map[string]interface{}{"from": "Jane", "to": "Joan"}},
+		},
+		{
+			name:  "created",
+			after: map[string]interface{}{"name": "Jane"},
+			want:  map[string]interface{}{"name": map[string]interface{}{"to": "Jane"}},
+		},
+		{
+			name:   "removed field",
+			before: map[string]interface{}{"name": "Jane"},
+			after:  map[string]interface{}{},
+			want:   map[string]interface{}{"name": map[string]interface{}{"from": "Jane"}},
+		},
+		{
+			name:   "sensitive values are not stored",
+			before: snapshot{Password: "old-hash"},
+			after:  snapshot{Password: "new-hash"},
+			want:   map[string]interface{}{"password": map[string]interface{}{"changed": true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := redact(map[string]interface{}{
+		"reason":          "support ticket",
+		"Refresh_Token":   "abc",
+		"client_secret":   "def",
+		"recovery_codes":  []string{"1", "2"},
+		"new_password":    "hunter2",
+		"target_email_id": 3,
+	})
+	want := map[string]interface{}{
+		"reason":          "support ticket",
+		"Refresh_Token":   redactedValue,
+		"client_secret":   redactedValue,
+		"recovery_codes":  redactedValue,
+		"new_password":    redactedValue,
+		"target_email_id": 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if redact(nil) != nil {
+		t.Error("empty metadata is not nil")
+	}
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"gorm.io/gorm"
+)
+
+// chainRecord - Fields covered by the hash. Changing the order or set of
+// fields invalidates every existing chain, fields added later must be
+// omitempty so that older events keep their hash.
+type chainRecord struct {
+	PrevHash         string          `json:"prev_hash"`
+	CreatedAt        string          `json:"created_at"`
+	ActorID          string          `json:"actor_id"`
+	ActorEmail       string          `json:"actor_email"`
+	ImpersonatorID   string          `json:"impersonator_id,omitempty"`
+	ServiceAccountID string          `json:"service_account_id,omitempty"`
+	Action           string          `json:"action"`
+	Outcome          string          `json:"outcome"`
+	TargetType       string          `json:"target_type"`
+	TargetID         string          `json:"target_id"`
+	Changes          json.RawMessage `json:"changes"`
+	Metadata         json.RawMessage `json:"metadata"`
+	IPAddress        string          `json:"ip_address"`
+	UserAgent        string          `json:"user_agent"`
+	RequestID        string          `json:"request_id"`
+}
+
+// hashEvent - SHA-256 over the previous hash and the event fields
+func hashEvent(event *models.AuditEvent) (string, error) {
+	record := chainRecord{
+		PrevHash:   event.PrevHash,
+		CreatedAt:  event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorEmail: event.ActorEmail,
+		Action:     event.Action,
+		Outcome:    event.Outcome,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IPAddress:  event.IPAddress,
+		UserAgent:  event.UserAgent,
+		RequestID:  event.RequestID,
+	}
+	if event.ActorID != nil {
+		record.ActorID = strconv.FormatUint(uint64(*event.ActorID), 10)
+	}
+	if event.ImpersonatorID != nil {
+		record.ImpersonatorID = strconv.FormatUint(uint64(*event.ImpersonatorID), 10)
+	}
+	if event.ServiceAccountID != nil {
+		record.ServiceAccountID = strconv.FormatUint(uint64(*event.ServiceAccountID), 10)
+	}
+
+	// jsonb does not keep the original formatting, hash a canonical form
+	var err error
+	if record.Changes, err = canonicalJSON(event.Changes); err != nil {
+		return "", err
+	}
+	if record.Metadata, err = canonicalJSON(event.Metadata); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON - Compact JSON with sorted object keys, nil for empty input
+func canonicalJSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(data)) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// VerifyResult - Outcome of a chain verification
+type VerifyResult struct {
+	Checked   int    // events verified before stopping
+	LastID    uint   // last event that was verified
+	BrokenID  uint   // first event that does not match, 0 when the chain is intact
+	BrokenWhy string // why BrokenID does not match
+}
+
+// Valid - Whether the whole chain matched
+func (r VerifyResult) Valid() bool {
+	return r.BrokenID == 0
+}
+
+func (r VerifyResult) String() string {
+	if r.Valid() {
+		return fmt.Sprintf("OK: %d event(s) verified, last id %d", r.Checked, r.LastID)
+	}
+	return fmt.Sprintf("BROKEN at id %d: %s (%d event(s) verified before it)", r.BrokenID, r.BrokenWhy, r.Checked)
+}
+
+// Verify - Recompute the chain from the first event. Detects edited rows and
+// rows removed from the middle. Removing the newest rows can only be noticed
+// by comparing with an earlier result (e.g. a saved last hash).
+func Verify(batchSize int) (VerifyResult, error) {
+	var result VerifyResult
+	prevHash := ""
+	var verifyErr error
+
+	// FindInBatches walks the table in primary key order
+	var events []models.AuditEvent
+	err := config.DB.FindInBatches(&events, batchSize, func(tx *gorm.DB, batch int) error {
+		var err error
+		prevHash, err = verifyEvents(events, prevHash, &result)
+		if err != nil && err != errStopVerify {
+			verifyErr = err
+			return errStopVerify
+		}
+		return err
+	}).Error
+	if err != nil && err != errStopVerify {
+		return result, err
+	}
+	return result, verifyErr
+}
+
+// verifyEvents - Check consecutive events against the chain ending in
+// prevHash and return the hash to continue with. Returns errStopVerify at the
+// first event that does not match, result tells which one and why.
+func verifyEvents(events []models.AuditEvent, prevHash string, result *VerifyResult) (string, error) {
+	for i := range events {
+		event := &events[i]
+		if event.PrevHash != prevHash {
+			result.BrokenID = event.ID
+			result.BrokenWhy = "previous hash does not match, an event before it was removed or changed"
+			return prevHash, errStopVerify
+		}
+
+		hash, err := hashEvent(event)
+		if err != nil {
+			return prevHash, err
+		}
+		if hash != event.Hash {
+			result.BrokenID = event.ID
+			result.BrokenWhy = "content does not match its hash"
+			return prevHash, errStopVerify
+		}
+
+		prevHash = event.Hash
+		result.Checked++
+		result.LastID = event.ID
+	}
+	return prevHash, nil
+}
+
+var errStopVerify = errors.New("stop verification")
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+// testChain - n linked events as Write stores them
+func testChain(t *testing.T, n int) []models.AuditEvent {
+	t.Helper()
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	actorID := uint(7)
+
+	events := make([]models.AuditEvent, n)
+	prevHash := ""
+	for i := range events {
+		event := &events[i]
+		*event = models.AuditEvent{
+			ID:         uint(i + 1),
+			CreatedAt:  start.Add(time.Duration(i) * time.Second),
+			ActorID:    &actorID,
+			ActorEmail: "admin@example.com",
+			Action:     "user.update",
+			Outcome:    OutcomeSuccess,
+			TargetType: "user",
+			TargetID:   "42",
+			Changes:    json.RawMessage(`{"name":{"from":"Jane","to":"Joan"}}`),
+			IPAddress:  "203.0.113.9",
+			PrevHash:   prevHash,
+		}
+		hash, err := hashEvent(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Hash = hash
+		prevHash = hash
+	}
+	return events
+}
+
+func TestHashEvent(t *testing.T) {
+	base := testChain(t, 1)[0]
+	impersonatorID := uint(1)
+
+	tests := []struct {
+		name     string
+		change   func(e *models.AuditEvent)
+		wantSame bool
+	}{
+		{name: "unchanged", change: func(e *models.AuditEvent) {}, wantSame: true},
+		{
+			name:     "created_at in another time zone",
+			change:   func(e *models.AuditEvent) { e.CreatedAt = e.CreatedAt.In(time.FixedZone("UTC+7", 7*3600)) },
+			wantSame: true,
+		},
+		{
+			// jsonb reorders keys and drops whitespace
+			name: "changes reformatted",
+			change: func(e *models.AuditEvent) {
+				e.Changes = json.RawMessage(`{ "name": { "to": "Joan", "from": "Jane" } }`)
+			},
+			wantSame: true,
+		},
+		{
+			name:     "hash and id are not covered",
+			change:   func(e *models.AuditEvent) { e.ID, e.Hash = 99, "" },
+			wantSame: true,
+		},
+		{name: "action", change: func(e *models.AuditEvent) { e.Action = "user.delete" }},
+		{name: "outcome", change: func(e *models.AuditEvent) { e.Outcome = OutcomeFailure }},
+		{name: "actor", change: func(e *models.AuditEvent) { e.ActorID = nil }},
+		{name: "impersonator", change: func(e *models.AuditEvent) { e.ImpersonatorID = &impersonatorID }},
+		{name: "target", change: func(e *models.AuditEvent) { e.TargetID = "43" }},
+		{name: "changes", change: func(e *models.AuditEvent) { e.Changes = json.RawMessage(`{"name":{"from":"Jane","to":"Jim"}}`) }},
+		{name: "metadata", change: func(e *models.AuditEvent) { e.Metadata = json.RawMessage(`{"reason":"x"}`) }},
+		{name: "created_at", change: func(e *models.AuditEvent) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) }},
+		{name: "previous hash", change: func(e *models.AuditEvent) { e.PrevHash = "00" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := base
+			tt.change(&event)
+			hash, err := hashEvent(&event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := hash == base.Hash; same != tt.wantSame {
+				t.Errorf("hash unchanged = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestHashEventRejectsInvalidJSON(t *testing.T) {
+	event := testChain(t, 1)[0]
+	event.Metadata = json.RawMessage(`{"reason":`)
+	if _, err := hashEvent(&event); err == nil {
+		t.Error("hashed event with invalid metadata JSON")
+	}
+}
+
+func TestVerifyEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(events []models.AuditEvent) []models.AuditEvent
+		wantChecked int
+		wantBroken  uint
+	}{
+		{
+			name:        "intact chain",
+			tamper:      func(events []models.AuditEvent) []models.AuditEvent { return events },
+			wantChecked: 5,
+		},
+		{
+			name: "edited event",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[2].Outcome = OutcomeFailure
+				return events
+			},
+			wantChecked: 2,
+			wantBroken:  3,
+		},
+		{
+			// The edited event verifies, the one after it no longer links to it
+			name: "edited event with recomputed hash",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[2].Outcome = OutcomeFailure
+				events[2].Hash, _ = hashEvent(&events[2])
+				return events
+			},
+			wantChecked: 3,
+			wantBroken:  4,
+		},
+		{
+			name: "removed event",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			wantChecked: 1,
+			wantBroken:  3,
+		},
+		{
+			name: "reordered events",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[3], events[4] = events[4], events[3]
+				return events
+			},
+			wantChecked: 3,
+			wantBroken:  5,
+		},
+		{
+			name: "first event removed",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return events[1:]
+			},
+			wantBroken: 2,
+		},
+		{
+			// Not detectable without a saved last hash
+			name: "newest event removed",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return events[:4]
+			},
+			wantChecked: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := tt.tamper(testChain(t, 5))
+
+			var result VerifyResult
+			_, err := verifyEvents(events, "", &result)
+			if tt.wantBroken == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantBroken != 0 && err != errStopVerify {
+				t.Fatalf("got error %v, want %v", err, errStopVerify)
+			}
+			if result.Checked != tt.wantChecked || result.BrokenID != tt.wantBroken {
+				t.Errorf("got checked %d broken %d, want checked %d broken %d (%s)",
+					result.Checked, result.BrokenID, tt.wantChecked, tt.wantBroken, result)
+			}
+			if result.Valid() != (tt.wantBroken == 0) {
+				t.Errorf("Valid() = %v", result.Valid())
+			}
+		})
+	}
+}
+
+func TestVerifyEventsAcrossBatches(t *testing.T) {
+	events := testChain(t, 5)
+
+	var result VerifyResult
+	prevHash, err := verifyEvents(events[:2], "", &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prevHash != events[1].Hash {
+		t.Fatalf("got continuation hash %s, want %s", prevHash, events[1].Hash)
+	}
+	if _, err := verifyEvents(events[2:], prevHash, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid() || result.Checked != 5 || result.LastID != 5 {
+		t.Errorf("got %s", result)
+	}
+}
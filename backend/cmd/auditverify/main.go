@@ -0,0 +1,58 @@
+// Command auditverify recomputes the hash chain of the audit log and reports
+// the first event that was changed or removed. Exits with status 1 when the
+// chain is broken.
+//
+//	go run ./cmd/auditverify
+//	go run ./cmd/auditverify -anchor <hash>   # also require a previously seen hash
+//
+// Deleting the newest events cannot be detected from the chain alone, keep
+// the printed last hash somewhere else and pass it as -anchor later.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	batch := flag.Int("batch", 1000, "events loaded per query")
+	anchor := flag.String("anchor", "", "hash of an earlier event that must still be in the chain")
+	flag.Parse()
+
+	config.Connect()
+
+	result, err := audit.Verify(*batch)
+	if err != nil {
+		log.Fatal("Failed to verify audit log:", err)
+	}
+	fmt.Println(result)
+	if !result.Valid() {
+		os.Exit(1)
+	}
+
+	if *anchor != "" {
+		var event models.AuditEvent
+		if err := config.DB.Where("hash = ?", *anchor).First(&event).Error; err != nil {
+			fmt.Printf("BROKEN: anchor %s not found, events were removed\n", *anchor)
+			os.Exit(1)
+		}
+		fmt.Printf("Anchor found at id %d\n", event.ID)
+	}
+
+	var last models.AuditEvent
+	if err := config.DB.Order("id DESC").Limit(1).Find(&last).Error; err == nil && last.ID != 0 {
+		fmt.Printf("Last hash: %s\n", last.Hash)
+	}
+}
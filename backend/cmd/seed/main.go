@@ -0,0 +1,53 @@
+// Command seed applies the RBAC manifest (roles, permissions and grants)
+// outside of server startup.
+//
+//	go run ./cmd/seed -dry-run            # show the diff only
+//	go run ./cmd/seed -file rbac.json     # apply another manifest
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"backend/config"
+)
+
+func main() {
+	// Load environment variables, RBAC_MANIFEST may come from .env
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	file := flag.String("file", config.SeedManifestPath(), "manifest file (YAML or JSON), empty for the built-in one")
+	dryRun := flag.Bool("dry-run", false, "print what would change without applying it")
+	flag.Parse()
+
+	manifest, err := config.LoadSeedManifest(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config.Connect()
+
+	if *dryRun {
+		plan, err := config.PlanSeed(manifest)
+		if err != nil {
+			log.Fatal("Failed to plan seed:", err)
+		}
+		fmt.Print(plan)
+		return
+	}
+
+	plan, err := config.ApplySeed(manifest)
+	if err != nil {
+		log.Fatal("Failed to apply seed:", err)
+	}
+	fmt.Print(plan)
+	if len(plan.Changes) > 0 {
+		fmt.Fprintf(os.Stderr, "Applied %d change(s). Running servers pick up permission changes within a minute.\n", len(plan.Changes))
+	}
+}
@@ -5,15 +5,24 @@ import (
 	"os"
 	"time"
 
-	"backend/models"
-
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// InitDatabase - Connect and seed roles and permissions
 func InitDatabase() {
+	Connect()
+
+	// Seed initial data
+	seedData()
+
+	log.Println("Database initialized successfully")
+}
+
+// Connect - Open the database connection without seeding, e.g. for commands
+func Connect() {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		dbURL = "host=localhost user=postgres password=postgres dbname=golang_nextjs port=5432 sslmode=disable"
@@ -34,34 +43,49 @@ func InitDatabase() {
 	//	&models.Role{},
 	//	&models.Permission{},
 	//	&models.RolePermission{},
+	//	&models.RevokedToken{},
+	//	&models.RefreshToken{},
+	//	&models.Session{},
+	//	&models.MFARecoveryCode{},
+	//	&models.WebAuthnCredential{},
+	//	&models.WebAuthnCeremony{},
+	//	&models.LoginAttempt{},
+	//	&models.RateLimitCounter{},
+	//	&models.PasswordReset{},
+	//	&models.Invitation{},
+	//	&models.UserStatusChange{},
+	//	&models.AuditEvent{},
+	//	&models.PersonalAccessToken{},
+	//	&models.ServiceAccount{},
+	//	&models.ServiceAccountSecret{},
 	// )
 
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
-	// Seed initial data
-	seedData()
-	log.Println("Database initialized successfully")
-
 	// Pooling setup (jangan terlalu tinggi karena Neon pakai PgBouncer)
 	sqlDB, _ := DB.DB()
 	sqlDB.SetMaxIdleConns(5)
 	sqlDB.SetMaxOpenConns(10)
 	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	log.Println("Database initialized successfully")
 }
 
+// seedData - Apply the RBAC manifest (RBAC_MANIFEST or the built-in rbac.yaml)
 func seedData() {
-	roles := []string{"admin", "manager", "user"}
-	for _, roleName := range roles {
-		var role models.Role
-		if err := DB.Where("name = ?", roleName).First(&role).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				DB.Create(&models.Role{Name: roleName})
-				log.Printf("Created role: %s", roleName)
-			}
-		}
+	manifest, err := LoadSeedManifest(SeedManifestPath())
+	if err != nil {
+		log.Fatal("Failed to load RBAC manifest:", err)
+	}
+
+	plan, err := ApplySeed(manifest)
+	if err != nil {
+		log.Fatal("Failed to seed roles and permissions:", err)
+	}
+	for _, change := range plan.Changes {
+		log.Printf("Seed: %s", change)
+	}
+	for _, warning := range plan.Warnings {
+		log.Printf("Seed warning: %s", warning)
 	}
 }
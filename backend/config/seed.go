@@ -0,0 +1,469 @@
+package config
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"backend/models"
+	"backend/validators"
+
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm"
+)
+
+//go:embed rbac.yaml
+var defaultSeedManifest []byte
+
+// SeedManifest - Declarative description of roles, permissions and grants
+type SeedManifest struct {
+	// Prune - Remove roles, permissions and grants that are not listed
+	Prune       bool             `yaml:"prune" json:"prune"`
+	Permissions []SeedPermission `yaml:"permissions" json:"permissions"`
+	Roles       []SeedRole       `yaml:"roles" json:"roles"`
+}
+
+type SeedPermission struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
+
+type SeedRole struct {
+	Name        string   `yaml:"name" json:"name"`
+	Parent      string   `yaml:"parent" json:"parent"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// Seed change kinds and actions
+const (
+	SeedKindPermission = "permission"
+	SeedKindRole       = "role"
+	SeedKindGrant      = "grant"
+
+	SeedCreate = "create"
+	SeedUpdate = "update"
+	SeedRemove = "remove"
+)
+
+// SeedChange - One difference between the manifest and the database
+type SeedChange struct {
+	Kind        string
+	Action      string
+	Name        string // permission or role name
+	Permission  string // grants only
+	Description string // desired permission description
+	Parent      string // desired role parent, "" for none
+	Detail      string
+}
+
+func (c SeedChange) String() string {
+	symbol := map[string]string{SeedCreate: "+", SeedUpdate: "~", SeedRemove: "-"}[c.Action]
+	line := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	if c.Kind == SeedKindGrant {
+		line += " -> " + c.Permission
+	}
+	if c.Detail != "" {
+		line += " (" + c.Detail + ")"
+	}
+	return line
+}
+
+// SeedPlan - Changes needed to bring the database in line with a manifest,
+// in the order they are applied
+type SeedPlan struct {
+	Changes  []SeedChange
+	Warnings []string
+}
+
+// String - Human readable diff
+func (p *SeedPlan) String() string {
+	var b strings.Builder
+	if len(p.Changes) == 0 {
+		b.WriteString("No changes, roles and permissions are up to date\n")
+	}
+	for _, change := range p.Changes {
+		b.WriteString(change.String() + "\n")
+	}
+	for _, warning := range p.Warnings {
+		b.WriteString("! " + warning + "\n")
+	}
+	return b.String()
+}
+
+// SeedManifestPath - Manifest file from RBAC_MANIFEST, empty means the built-in one
+func SeedManifestPath() string {
+	return os.Getenv("RBAC_MANIFEST")
+}
+
+// LoadSeedManifest - Read and validate a manifest. JSON is accepted as well,
+// it is a subset of YAML. An empty path loads the built-in manifest.
+func LoadSeedManifest(path string) (*SeedManifest, error) {
+	data := defaultSeedManifest
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest SeedManifest
+	if err := yaml.UnmarshalWithOptions(data, &manifest, yaml.DisallowUnknownField()); err != nil {
+		return nil, fmt.Errorf("invalid RBAC manifest: %w", err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid RBAC manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Validate - Names are well-formed and unique, every reference is declared
+// and the role hierarchy has no cycles
+func (m *SeedManifest) Validate() error {
+	permissions := make(map[string]bool)
+	for _, permission := range m.Permissions {
+		if !validators.ValidatePermissionName(permission.Name) {
+			return fmt.Errorf("permission %q must look like 'resource:action'", permission.Name)
+		}
+		if permissions[permission.Name] {
+			return fmt.Errorf("permission %q is declared twice", permission.Name)
+		}
+		permissions[permission.Name] = true
+	}
+
+	parents := make(map[string]string)
+	for _, role := range m.Roles {
+		if !validators.ValidateRoleName(role.Name) {
+			return fmt.Errorf("role name %q must be 2-50 lowercase letters, digits, '_' or '-'", role.Name)
+		}
+		if _, ok := parents[role.Name]; ok {
+			return fmt.Errorf("role %q is declared twice", role.Name)
+		}
+		parents[role.Name] = role.Parent
+
+		for _, permission := range role.Permissions {
+			if !permissions[permission] {
+				return fmt.Errorf("role %q grants undeclared permission %q", role.Name, permission)
+			}
+		}
+	}
+
+	for _, role := range m.Roles {
+		if role.Parent == "" {
+			continue
+		}
+		if _, ok := parents[role.Parent]; !ok {
+			return fmt.Errorf("role %q has undeclared parent %q", role.Name, role.Parent)
+		}
+		visited := map[string]bool{role.Name: true}
+		for parent := role.Parent; parent != ""; parent = parents[parent] {
+			if visited[parent] {
+				return fmt.Errorf("role %q is part of a cycle in the role hierarchy", role.Name)
+			}
+			visited[parent] = true
+		}
+	}
+
+	// Pruning must not lock everybody out of role management
+	if m.Prune {
+		for _, role := range m.Roles {
+			for _, permission := range role.Permissions {
+				if permission == models.PermRolesWrite {
+					return nil
+				}
+			}
+		}
+		return errors.New("prune requires a role granting " + models.PermRolesWrite)
+	}
+	return nil
+}
+
+// seedState - Roles, permissions and grants currently stored
+type seedState struct {
+	roles                map[string]models.Role
+	permissions          map[string]models.Permission
+	grants               map[string]map[string]bool // role name -> permission names
+	userCounts           map[uint]int64             // role ID -> users
+	serviceAccountCounts map[uint]int64             // role ID -> service accounts
+}
+
+func loadSeedState(db *gorm.DB) (*seedState, error) {
+	state := &seedState{
+		roles:                make(map[string]models.Role),
+		permissions:          make(map[string]models.Permission),
+		grants:               make(map[string]map[string]bool),
+		userCounts:           make(map[uint]int64),
+		serviceAccountCounts: make(map[uint]int64),
+	}
+
+	var roles []models.Role
+	if err := db.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		state.roles[role.Name] = role
+	}
+
+	var permissions []models.Permission
+	if err := db.Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	for _, permission := range permissions {
+		state.permissions[permission.Name] = permission
+	}
+
+	var grants []struct {
+		RoleName       string
+		PermissionName string
+	}
+	err := db.Table("role_permissions").
+		Select("roles.name AS role_name, permissions.name AS permission_name").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("roles.deleted_at IS NULL AND permissions.deleted_at IS NULL").
+		Scan(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		if state.grants[grant.RoleName] == nil {
+			state.grants[grant.RoleName] = make(map[string]bool)
+		}
+		state.grants[grant.RoleName][grant.PermissionName] = true
+	}
+
+	var counts []struct {
+		RoleID uint
+		Count  int64
+	}
+	if err := db.Model(&models.User{}).Select("role_id, count(*) AS count").Group("role_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		state.userCounts[count.RoleID] = count.Count
+	}
+
+	counts = nil
+	if err := db.Model(&models.ServiceAccount{}).Select("role_id, count(*) AS count").Group("role_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		state.serviceAccountCounts[count.RoleID] = count.Count
+	}
+	return state, nil
+}
+
+// PlanSeed - Diff the manifest against the database without changing anything
+func PlanSeed(m *SeedManifest) (*SeedPlan, error) {
+	state, err := loadSeedState(DB)
+	if err != nil {
+		return nil, err
+	}
+	return planSeed(m, state), nil
+}
+
+func planSeed(m *SeedManifest, state *seedState) *SeedPlan {
+	plan := &SeedPlan{}
+	add := func(change SeedChange) { plan.Changes = append(plan.Changes, change) }
+
+	for _, permission := range m.Permissions {
+		existing, ok := state.permissions[permission.Name]
+		switch {
+		case !ok:
+			add(SeedChange{Kind: SeedKindPermission, Action: SeedCreate, Name: permission.Name, Description: permission.Description})
+		case existing.Description != permission.Description:
+			add(SeedChange{Kind: SeedKindPermission, Action: SeedUpdate, Name: permission.Name, Description: permission.Description,
+				Detail: fmt.Sprintf("description %q -> %q", existing.Description, permission.Description)})
+		}
+	}
+
+	// Roles are created first and get their parent afterwards, so the order
+	// of roles in the manifest does not matter
+	for _, role := range m.Roles {
+		if _, ok := state.roles[role.Name]; !ok {
+			add(SeedChange{Kind: SeedKindRole, Action: SeedCreate, Name: role.Name})
+		}
+	}
+	roleIDs := make(map[uint]string, len(state.roles))
+	for name, role := range state.roles {
+		roleIDs[role.ID] = name
+	}
+	for _, role := range m.Roles {
+		current := ""
+		if existing, ok := state.roles[role.Name]; ok && existing.ParentID != nil {
+			current = roleIDs[*existing.ParentID]
+		}
+		if current != role.Parent {
+			add(SeedChange{Kind: SeedKindRole, Action: SeedUpdate, Name: role.Name, Parent: role.Parent,
+				Detail: fmt.Sprintf("parent %s -> %s", orNone(current), orNone(role.Parent))})
+		}
+	}
+
+	declaredRoles := make(map[string]bool, len(m.Roles))
+	for _, role := range m.Roles {
+		declaredRoles[role.Name] = true
+		desired := make(map[string]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			desired[permission] = true
+			if !state.grants[role.Name][permission] {
+				add(SeedChange{Kind: SeedKindGrant, Action: SeedCreate, Name: role.Name, Permission: permission})
+			}
+		}
+		if m.Prune {
+			for _, permission := range sortedKeys(state.grants[role.Name]) {
+				if !desired[permission] {
+					add(SeedChange{Kind: SeedKindGrant, Action: SeedRemove, Name: role.Name, Permission: permission})
+				}
+			}
+		}
+	}
+
+	if !m.Prune {
+		return plan
+	}
+
+	for _, name := range sortedKeys(state.roles) {
+		if declaredRoles[name] {
+			continue
+		}
+		if state.userCounts[state.roles[name].ID] > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("role %s is not in the manifest but still has users, kept", name))
+			continue
+		}
+		if state.serviceAccountCounts[state.roles[name].ID] > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("role %s is not in the manifest but still has service accounts, kept", name))
+			continue
+		}
+		add(SeedChange{Kind: SeedKindRole, Action: SeedRemove, Name: name})
+	}
+
+	declaredPermissions := make(map[string]bool, len(m.Permissions))
+	for _, permission := range m.Permissions {
+		declaredPermissions[permission.Name] = true
+	}
+	for _, name := range sortedKeys(state.permissions) {
+		if declaredPermissions[name] {
+			continue
+		}
+		if isBuiltinPermission(name) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("permission %s is used by routes but not in the manifest, kept", name))
+			continue
+		}
+		add(SeedChange{Kind: SeedKindPermission, Action: SeedRemove, Name: name})
+	}
+	return plan
+}
+
+// ApplySeed - Bring the database in line with the manifest in one transaction
+// and return the applied changes
+func ApplySeed(m *SeedManifest) (*SeedPlan, error) {
+	var plan *SeedPlan
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadSeedState(tx)
+		if err != nil {
+			return err
+		}
+		plan = planSeed(m, state)
+
+		for _, change := range plan.Changes {
+			if err := applySeedChange(tx, change); err != nil {
+				return fmt.Errorf("%s: %w", change, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func applySeedChange(tx *gorm.DB, change SeedChange) error {
+	switch change.Kind + ":" + change.Action {
+	case SeedKindPermission + ":" + SeedCreate:
+		return tx.Create(&models.Permission{Name: change.Name, Description: change.Description}).Error
+
+	case SeedKindPermission + ":" + SeedUpdate:
+		return tx.Model(&models.Permission{}).Where("name = ?", change.Name).Update("description", change.Description).Error
+
+	case SeedKindPermission + ":" + SeedRemove:
+		var permission models.Permission
+		if err := tx.Where("name = ?", change.Name).First(&permission).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("permission_id = ?", permission.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&permission).Error
+
+	case SeedKindRole + ":" + SeedCreate:
+		return tx.Create(&models.Role{Name: change.Name}).Error
+
+	case SeedKindRole + ":" + SeedUpdate:
+		var parentID *uint
+		if change.Parent != "" {
+			var parent models.Role
+			if err := tx.Where("name = ?", change.Parent).First(&parent).Error; err != nil {
+				return err
+			}
+			parentID = &parent.ID
+		}
+		return tx.Model(&models.Role{}).Where("name = ?", change.Name).Update("parent_id", parentID).Error
+
+	case SeedKindRole + ":" + SeedRemove:
+		var role models.Role
+		if err := tx.Where("name = ?", change.Name).First(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Role{}).Where("parent_id = ?", role.ID).Update("parent_id", role.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&role).Error
+
+	case SeedKindGrant + ":" + SeedCreate, SeedKindGrant + ":" + SeedRemove:
+		var role models.Role
+		if err := tx.Where("name = ?", change.Name).First(&role).Error; err != nil {
+			return err
+		}
+		var permission models.Permission
+		if err := tx.Where("name = ?", change.Permission).First(&permission).Error; err != nil {
+			return err
+		}
+		if change.Action == SeedCreate {
+			return tx.Create(&models.RolePermission{RoleID: role.ID, PermissionID: permission.ID}).Error
+		}
+		return tx.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).Delete(&models.RolePermission{}).Error
+	}
+
+	return fmt.Errorf("unknown seed change %s %s", change.Action, change.Kind)
+}
+
+func isBuiltinPermission(name string) bool {
+	for _, builtin := range models.BuiltinPermissions {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+func orNone(name string) string {
+	if name == "" {
+		return "none"
+	}
+	return name
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"backend/models"
+)
+
+func TestSeedManifestValidate(t *testing.T) {
+	permissions := []SeedPermission{{Name: "users:read"}, {Name: models.PermRolesWrite}}
+
+	tests := []struct {
+		name     string
+		manifest SeedManifest
+		wantErr  string
+	}{
+		{
+			name: "valid hierarchy",
+			manifest: SeedManifest{Permissions: permissions, Roles: []SeedRole{
+				{Name: "admin", Permissions: []string{models.PermRolesWrite}},
+				{Name: "viewer", Parent: "admin", Permissions: []string{"users:read"}},
+			}},
+		},
+		{
+			name:     "malformed permission name",
+			manifest: SeedManifest{Permissions: []SeedPermission{{Name: "users"}}},
+			wantErr:  `permission "users" must look like 'resource:action'`,
+		},
+		{
+			name:     "duplicate permission",
+			manifest: SeedManifest{Permissions: []SeedPermission{{Name: "users:read"}, {Name: "users:read"}}},
+			wantErr:  `permission "users:read" is declared twice`,
+		},
+		{
+			name:     "malformed role name",
+			manifest: SeedManifest{Roles: []SeedRole{{Name: "Admin"}}},
+			wantErr:  `role name "Admin" must be`,
+		},
+		{
+			name:     "duplicate role",
+			manifest: SeedManifest{Roles: []SeedRole{{Name: "admin"}, {Name: "admin"}}},
+			wantErr:  `role "admin" is declared twice`,
+		},
+		{
+			name:     "undeclared permission",
+			manifest: SeedManifest{Roles: []SeedRole{{Name: "admin", Permissions: []string{"audit:read"}}}},
+			wantErr:  `role "admin" grants undeclared permission "audit:read"`,
+		},
+		{
+			name:     "undeclared parent",
+			manifest: SeedManifest{Roles: []SeedRole{{Name: "viewer", Parent: "admin"}}},
+			wantErr:  `role "viewer" has undeclared parent "admin"`,
+		},
+		{
+			name:     "own parent",
+			manifest: SeedManifest{Roles: []SeedRole{{Name: "admin", Parent: "admin"}}},
+			wantErr:  `role "admin" is part of a cycle`,
+		},
+		{
+			name: "longer cycle",
+			manifest: SeedManifest{Roles: []SeedRole{
+				{Name: "aa", Parent: "cc"},
+				{Name: "bb", Parent: "aa"},
+				{Name: "cc", Parent: "bb"},
+			}},
+			wantErr: `role "aa" is part of a cycle`,
+		},
+		{
+			name: "prune without role admin",
+			manifest: SeedManifest{Prune: true, Permissions: permissions, Roles: []SeedRole{
+				{Name: "viewer", Permissions: []string{"users:read"}},
+			}},
+			wantErr: "prune requires a role granting " + models.PermRolesWrite,
+		},
+		{
+			name: "prune with role admin",
+			manifest: SeedManifest{Prune: true, Permissions: permissions, Roles: []SeedRole{
+				{Name: "admin", Permissions: []string{models.PermRolesWrite}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSeedManifest(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "built-in manifest", path: ""},
+		{
+			name: "yaml file",
+			path: write("rbac.yaml", "permissions:\n  - name: users:read\nroles:\n  - name: viewer\n    permissions: [users:read]\n"),
+		},
+		{
+			name: "json file",
+			path: write("rbac.json", `{"permissions": [{"name": "users:read"}], "roles": [{"name": "viewer"}]}`),
+		},
+		{name: "unknown field", path: write("unknown.yaml", "roles:\n  - name: viewer\n    parents: [admin]\n"), wantErr: true},
+		{name: "invalid manifest", path: write("invalid.yaml", "roles:\n  - name: viewer\n    parent: admin\n"), wantErr: true},
+		{name: "missing file", path: filepath.Join(dir, "missing.yaml"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSeedManifest(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testSeedState - admin <- editor with a few grants, a role kept by its users,
+// one kept by its service account and an unused one
+func testSeedState() *seedState {
+	adminID := uint(1)
+	return &seedState{
+		roles: map[string]models.Role{
+			"admin":  {ID: 1, Name: "admin"},
+			"editor": {ID: 2, Name: "editor", ParentID: &adminID},
+			"legacy": {ID: 3, Name: "legacy"},
+			"bots":   {ID: 4, Name: "bots"},
+			"unused": {ID: 5, Name: "unused"},
+		},
+		permissions: map[string]models.Permission{
+			models.PermRolesWrite: {Name: models.PermRolesWrite},
+			"posts:write":         {Name: "posts:write", Description: "Write posts"},
+			"posts:archive":       {Name: "posts:archive"},
+		},
+		grants: map[string]map[string]bool{
+			"admin":  {models.PermRolesWrite: true},
+			"editor": {"posts:write": true, "posts:archive": true},
+		},
+		userCounts:           map[uint]int64{1: 1, 2: 4, 3: 2},
+		serviceAccountCounts: map[uint]int64{4: 1},
+	}
+}
+
+func TestPlanSeed(t *testing.T) {
+	manifest := func(prune bool) *SeedManifest {
+		return &SeedManifest{
+			Prune: prune,
+			Permissions: []SeedPermission{
+				{Name: models.PermRolesWrite},
+				{Name: "posts:write", Description: "Create and edit posts"},
+				{Name: "posts:read"},
+			},
+			Roles: []SeedRole{
+				{Name: "viewer", Parent: "editor", Permissions: []string{"posts:read"}},
+				{Name: "editor", Permissions: []string{"posts:write"}},
+				{Name: "admin", Permissions: []string{models.PermRolesWrite}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		manifest     *SeedManifest
+		state        *seedState
+		wantChanges  []string
+		wantWarnings []string
+	}{
+		{
+			name:     "empty database",
+			manifest: manifest(false),
+			state: &seedState{
+				roles:       map[string]models.Role{},
+				permissions: map[string]models.Permission{},
+				grants:      map[string]map[string]bool{},
+			},
+			wantChanges: []string{
+				"+ permission " + models.PermRolesWrite,
+				"+ permission posts:write",
+				"+ permission posts:read",
+				"+ role viewer",
+				"+ role editor",
+				"+ role admin",
+				"~ role viewer (parent none -> editor)",
+				"+ grant viewer -> posts:read",
+				"+ grant editor -> posts:write",
+				"+ grant admin -> " + models.PermRolesWrite,
+			},
+		},
+		{
+			name:     "without prune only adds and updates",
+			manifest: manifest(false),
+			state:    testSeedState(),
+			wantChanges: []string{
+				`~ permission posts:write (description "Write posts" -> "Create and edit posts")`,
+				"+ permission posts:read",
+				"+ role viewer",
+				"~ role viewer (parent none -> editor)",
+				"~ role editor (parent admin -> none)",
+				"+ grant viewer -> posts:read",
+			},
+		},
+		{
+			name:     "prune keeps roles in use and builtin permissions",
+			manifest: manifest(true),
+			state: func() *seedState {
+				state := testSeedState()
+				state.permissions[models.PermAuditRead] = models.Permission{Name: models.PermAuditRead}
+				return state
+			}(),
+			wantChanges: []string{
+				`~ permission posts:write (description "Write posts" -> "Create and edit posts")`,
+				"+ permission posts:read",
+				"+ role viewer",
+				"~ role viewer (parent none -> editor)",
+				"~ role editor (parent admin -> none)",
+				"+ grant viewer -> posts:read",
+				"- grant editor -> posts:archive",
+				"- role unused",
+				"- permission posts:archive",
+			},
+			wantWarnings: []string{
+				"role bots is not in the manifest but still has service accounts, kept",
+				"role legacy is not in the manifest but still has users, kept",
+				"permission " + models.PermAuditRead + " is used by routes but not in the manifest, kept",
+			},
+		},
+		{
+			name: "up to date",
+			manifest: &SeedManifest{
+				Permissions: []SeedPermission{{Name: "posts:write", Description: "Write posts"}},
+				Roles:       []SeedRole{{Name: "editor", Parent: "admin", Permissions: []string{"posts:write"}}},
+			},
+			state: testSeedState(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planSeed(tt.manifest, tt.state)
+
+			var changes []string
+			for _, change := range plan.Changes {
+				changes = append(changes, change.String())
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("changes:\n got %q\nwant %q", changes, tt.wantChanges)
+			}
+			if !reflect.DeepEqual(plan.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings:\n got %q\nwant %q", plan.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
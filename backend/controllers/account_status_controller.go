@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/audit"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetUserStatus - Admin: move a user to another account status.
+// Body: {status, reason, expires_at (RFC 3339, suspensions only)}
+func SetUserStatus(c *gin.Context) {
+	id, ok := parseID(c, "id", "user")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status    string     `json:"status" binding:"required"`
+		Reason    string     `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status is required", "details": err.Error()})
+		return
+	}
+
+	actorID := c.GetUint("userID")
+	if id == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change the status of your own account"})
+		return
+	}
+
+	before, err := userService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user, err := accountStatusService.Transition(id, req.Status, strings.TrimSpace(req.Reason), req.ExpiresAt, &actorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrInvalidStatusTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUnknownAccountStatus),
+			errors.Is(err, services.ErrStatusReasonRequired),
+			errors.Is(err, services.ErrInvalidStatusExpiry):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change account status"})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserStatus,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     statusAuditView(before),
+		After:      statusAuditView(user),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account status changed to " + user.Status, "user": user})
+}
+
+// GetUserStatusHistory - Admin: status changes of a user, newest first
+func GetUserStatusHistory(c *gin.Context) {
+	id, ok := parseID(c, "id", "user")
+	if !ok {
+		return
+	}
+
+	if _, err := userService.GetUserByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	history, err := accountStatusService.History(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
@@ -1,24 +1,169 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"backend/audit"
 	"backend/config"
 	"backend/models"
+	"backend/services"
+	"backend/validators"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	userService   = services.NewUserService()
+	searchService = services.NewSearchService()
+)
+
+// GetUsers - Admin: paginated user list.
+//
+//	page, limit         offset pagination (limit max 100)
+//	cursor              keyset pagination, use next_cursor of the previous page
+//	role                role name or ID
+//	status              verified, unverified or an account status
+//	created_from/to     RFC 3339 or YYYY-MM-DD (created_to inclusive for dates)
+//	q                   search in name and email
+//	sort                e.g. -created_at,name
 func GetUsers(c *gin.Context) {
-	var users []models.User
-	if err := config.DB.Preload("Role").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+	query, ok := parseUserListQuery(c)
+	if !ok {
+		return
+	}
+
+	result, err := userService.ListUsers(query)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrInvalidStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		}
+		return
+	}
+
+	pagination := gin.H{
+		"limit":       query.Limit,
+		"total":       result.Total,
+		"has_more":    result.HasMore,
+		"next_cursor": result.NextCursor,
+	}
+	if query.Cursor == "" {
+		pagination["page"] = query.Page
+		pagination["total_pages"] = (result.Total + int64(query.Limit) - 1) / int64(query.Limit)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      result.Users,
+		"pagination": pagination,
+	})
+}
+
+// SearchUsers - Admin: ranked fuzzy search by name and email (?q=, limit max 50)
+func SearchUsers(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	limit := services.DefaultUserSearchLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > services.MaxUserSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(services.MaxUserSearchLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	results, err := searchService.SearchUsers(query, limit)
+	if err != nil {
+		log.Printf("User search failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"backend": searchService.Backend(),
+		"results": results,
+	})
+}
+
+// parseUserListQuery - Read and validate user list query parameters
+func parseUserListQuery(c *gin.Context) (services.UserListQuery, bool) {
+	query := services.UserListQuery{
+		Page:   1,
+		Limit:  services.DefaultUserListLimit,
+		Cursor: c.Query("cursor"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+		Search: c.Query("q"),
+	}
+
+	invalid := func(message string) (services.UserListQuery, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return query, false
+	}
+
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return invalid("page must be a positive number")
+		}
+		query.Page = page
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > services.MaxUserListLimit {
+			return invalid("limit must be between 1 and " + strconv.Itoa(services.MaxUserListLimit))
+		}
+		query.Limit = limit
+	}
+
+	sorts, err := services.ParseUserSort(c.DefaultQuery("sort", "id"))
+	if err != nil {
+		return invalid(err.Error())
+	}
+	query.Sort = sorts
+
+	if value := c.Query("created_from"); value != "" {
+		from, _, err := parseDateParam(value)
+		if err != nil {
+			return invalid("created_from must be RFC 3339 or YYYY-MM-DD")
+		}
+		query.CreatedFrom = &from
+	}
+	if value := c.Query("created_to"); value != "" {
+		to, dateOnly, err := parseDateParam(value)
+		if err != nil {
+			return invalid("created_to must be RFC 3339 or YYYY-MM-DD")
+		}
+		// A date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query.CreatedTo = &to
+	}
+
+	return query, true
+}
+
+// parseDateParam - Parse RFC 3339 timestamp or YYYY-MM-DD date
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
 }
 
 func CreateUser(c *gin.Context) {
@@ -27,6 +172,14 @@ func CreateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.RoleID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": gin.H{"role_id": "must be a valid role ID"}})
+		return
+	}
+	if err := config.DB.First(&models.Role{}, req.RoleID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": gin.H{"role_id": "role does not exist"}})
+		return
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -39,6 +192,7 @@ func CreateUser(c *gin.Context) {
 		Email:    req.Email,
 		Password: string(hashedPassword),
 		RoleID:   req.RoleID,
+		Status:   models.AccountStatusActive,
 	}
 
 	if err := config.DB.Create(&user).Error; err != nil {
@@ -46,9 +200,18 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserCreate,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		After:      userAuditView(&user),
+	})
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "user": user})
 }
 
+// UpdateUser - Admin: partial update of a user (JSON Merge Patch), only
+// name, email, password and role_id can be changed
 func UpdateUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -62,25 +225,54 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	req, valid := validators.ValidateUpdateUserRequest(c)
+	if !valid {
+		return // Error response sudah dikirim di validator
 	}
 
-	// Hash password if it's being updated
-	if password, exists := updateData["password"]; exists {
-		if passwordStr, ok := password.(string); ok && passwordStr != "" {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordStr), bcrypt.DefaultCost)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-				return
-			}
-			updateData["password"] = string(hashedPassword)
+	updateData := map[string]interface{}{}
+	if req.Name != nil {
+		updateData["name"] = *req.Name
+	}
+	if req.Email != nil && *req.Email != user.Email {
+		var count int64
+		config.DB.Model(&models.User{}).Where("email = ? AND id <> ?", *req.Email, user.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+		updateData["email"] = *req.Email
+		// The new address has not been verified yet
+		updateData["email_verified_at"] = nil
+	}
+	if req.RoleID != nil {
+		if err := config.DB.First(&models.Role{}, *req.RoleID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": gin.H{"role_id": "role does not exist"}})
+			return
+		}
+		updateData["role_id"] = *req.RoleID
+	}
+	if req.Password != nil {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
 		}
+		updateData["password"] = string(hashedPassword)
 	}
 
-	if err := config.DB.Model(&user).Updates(updateData).Error; err != nil {
+	before := userAuditView(&user)
+	record := audit.InTx(c, func() audit.Event {
+		return audit.Event{
+			Action:     audit.ActionUserUpdate,
+			TargetType: audit.TargetUser,
+			TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+			Before:     before,
+			After:      userAuditView(&user),
+			Metadata:   gin.H{"credentials_changed": req.Password != nil},
+		}
+	})
+	if err := userService.UpdateUser(&user, updateData, record); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -95,14 +287,147 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&models.User{}, id).Error; err != nil {
+	user, err := userService.GetUserByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := userService.DeleteUser(user.ID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserDelete,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Before:     userAuditView(user),
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// GetDeletedUsers - Admin: soft-deleted users with their purge date
+func GetDeletedUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultUserListLimit)))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > services.MaxUserListLimit {
+		limit = services.DefaultUserListLimit
+	}
+
+	users, total, err := userService.ListDeletedUsers(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":          users,
+		"retention_days": services.UserRetentionDays(),
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// RestoreUser - Admin: undo the deletion of a user
+func RestoreUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := userService.RestoreUser(uint(id))
+	if err != nil {
+		respondTrashError(c, err, "Failed to restore user")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserRestore,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		After:      userAuditView(user),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User restored successfully", "user": user})
+}
+
+// PurgeUser - Admin: permanently delete a deleted user
+func PurgeUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := userService.PurgeUser(uint(id)); err != nil {
+		respondTrashError(c, err, "Failed to purge user")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserPurge,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(id),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User permanently deleted"})
+}
+
+func respondTrashError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrUserNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not deleted"})
+	case errors.Is(err, services.ErrEmailAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is in use by another account"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// RevokeUserTokens - Revoke every access and refresh token issued to a user
+func RevokeUserTokens(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := revocationService.RevokeAllForUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserRevoke,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "All tokens for user revoked successfully"})
+}
+
 func GetAdminDashboard(c *gin.Context) {
 	// Get some stats for admin dashboard
 	var userCount int64
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/audit"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit log limits
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// userAuditView - User fields recorded in audit diffs
+func userAuditView(user *models.User) gin.H {
+	return gin.H{
+		"name":              user.Name,
+		"email":             user.Email,
+		"role_id":           user.RoleID,
+		"status":            user.Status,
+		"email_verified_at": user.EmailVerifiedAt,
+		"mfa_enabled":       user.MFAEnabled,
+	}
+}
+
+// statusAuditView - Account status fields recorded in audit diffs
+func statusAuditView(user *models.User) gin.H {
+	return gin.H{
+		"status":            user.Status,
+		"status_reason":     user.StatusReason,
+		"status_expires_at": user.StatusExpiresAt,
+	}
+}
+
+// roleAuditView - Role fields recorded in audit diffs
+func roleAuditView(role *models.Role) gin.H {
+	if role == nil {
+		return nil
+	}
+	return gin.H{"name": role.Name, "parent_id": role.ParentID}
+}
+
+// GetAuditEvents - Admin: audit log, newest first.
+//
+//	actor_id, impersonator_id, service_account_id, action (exact or prefix
+//	like user.*), outcome, target_type, target_id, request_id,
+//	from/to (RFC 3339 or YYYY-MM-DD), page, limit
+func GetAuditEvents(c *gin.Context) {
+	filter := audit.Filter{
+		Action:     c.Query("action"),
+		Outcome:    c.Query("outcome"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+		Page:       1,
+		Limit:      defaultAuditLimit,
+	}
+
+	invalid := func(message string) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+
+	if value := c.Query("actor_id"); value != "" {
+		actorID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			invalid("actor_id must be a user ID")
+			return
+		}
+		id := uint(actorID)
+		filter.ActorID = &id
+	}
+	if value := c.Query("impersonator_id"); value != "" {
+		impersonatorID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			invalid("impersonator_id must be a user ID")
+			return
+		}
+		id := uint(impersonatorID)
+		filter.ImpersonatorID = &id
+	}
+	if value := c.Query("service_account_id"); value != "" {
+		serviceAccountID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			invalid("service_account_id must be a service account ID")
+			return
+		}
+		id := uint(serviceAccountID)
+		filter.ServiceAccountID = &id
+	}
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			invalid("page must be a positive number")
+			return
+		}
+		filter.Page = page
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			invalid("limit must be between 1 and " + strconv.Itoa(maxAuditLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseDateParam(value)
+		if err != nil {
+			invalid("from must be RFC 3339 or YYYY-MM-DD")
+			return
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseDateParam(value)
+		if err != nil {
+			invalid("to must be RFC 3339 or YYYY-MM-DD")
+			return
+		}
+		// A date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	events, total, err := audit.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":        filter.Page,
+			"limit":       filter.Limit,
+			"total":       total,
+			"total_pages": (total + int64(filter.Limit) - 1) / int64(filter.Limit),
+		},
+	})
+}
@@ -1,10 +1,19 @@
 package controllers
 
 import (
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"backend/audit"
 	"backend/config"
+	"backend/mailer"
 	"backend/models"
+	"backend/services"
 	"backend/utils"
 	"backend/validators"
 
@@ -12,6 +21,17 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	revocationService    = services.NewRevocationService()
+	refreshTokenService  = services.NewRefreshTokenService()
+	sessionService       = services.NewSessionService()
+	verificationService  = services.NewVerificationService()
+	passwordResetService = services.NewPasswordResetService()
+	permissionService    = services.NewPermissionService()
+	registrationService  = services.NewRegistrationService()
+	accountStatusService = services.NewAccountStatusService()
+)
+
 func Register(c *gin.Context) {
 	// Gunakan validator untuk validasi request
 	req, valid := validators.ValidateRegisterRequest(c)
@@ -26,16 +46,6 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Set default role if not provided
-	if req.RoleID == 0 {
-		var userRole models.Role
-		if err := config.DB.Where("name = ?", "user").First(&userRole).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Default role not found"})
-			return
-		}
-		req.RoleID = userRole.ID
-	}
-
 	// Check if email already exists
 	var existingUser models.User
 	if err := config.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
@@ -43,25 +53,64 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Create user
-	user := models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		RoleID:   req.RoleID,
+	// Role comes from the registration policy, never verbatim from the request
+	user, err := registrationService.Register(req.Name, req.Email, string(hashedPassword), req.RoleID, req.InvitationToken)
+	if err != nil {
+		switch err {
+		case services.ErrRoleNotAllowed:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Requested role is not available for registration"})
+		case services.ErrInvalidInvitation:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		case services.ErrDefaultRoleMissing:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Default role not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRegister,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		After:      userAuditView(user),
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		Metadata:   gin.H{"invitation": req.InvitationToken != ""},
+	})
+
+	message := "User created successfully"
+	if user.Status == models.AccountStatusPending {
+		message += ", an administrator has to approve the account before you can sign in"
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": message,
+			"user": gin.H{
+				"id":             user.ID,
+				"name":           user.Name,
+				"email":          user.Email,
+				"email_verified": true,
+				"status":         user.Status,
+			},
+		})
 		return
 	}
 
+	// Prove ownership of the address
+	if err := verificationService.SendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
+		"message": message + ", please check your email to verify your address",
 		"user": gin.H{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": false,
+			"status":         user.Status,
 		},
 	})
 }
@@ -73,38 +122,182 @@ func Login(c *gin.Context) {
 		return // Error response sudah dikirim di validator
 	}
 
+	// Brute-force protection per account and per client IP
+	if wait, err := services.DefaultLoginLimiter().Check(req.Email, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	} else if wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
+
 	// Find user
 	var user models.User
 	if err := config.DB.Preload("Role").Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		loginFailed(c, req.Email, "Invalid credentials")
 		return
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		loginFailed(c, req.Email, "Invalid credentials")
 		return
 	}
 
-	// Create JWT token
-	tokenString, err := utils.GenerateJWT(user.ID, user.Email, user.Role.Name)
+	if !loginAllowedByVerification(c, &user) || !loginAllowedByStatus(c, &user) {
+		return
+	}
+
+	// Two-factor enabled: return a short-lived challenge instead of tokens
+	if user.MFAEnabled {
+		respondMFAChallenge(c, &user, webAuthnService.HasCredentials(user.ID))
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// respondMFAChallenge - Ask for the second factor with a short-lived MFA token
+// instead of issuing tokens
+func respondMFAChallenge(c *gin.Context, user *models.User, allowPasskey bool) {
+	mfaToken, err := utils.GenerateMFAToken(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create MFA token"})
+		return
+	}
+
+	methods := []string{"totp", "recovery_code"}
+	if allowPasskey {
+		methods = append(methods, "webauthn")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Two-factor authentication required",
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"mfa_methods":  methods,
+		"expires_in":   "5m",
+	})
+}
+
+// loginAllowedByVerification - Enforce the block_login email verification policy
+func loginAllowedByVerification(c *gin.Context, user *models.User) bool {
+	if user.EmailVerifiedAt == nil && services.EmailVerificationPolicy() == services.VerificationBlockLogin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "Please verify your email address before logging in",
+			"email_verified": false,
+		})
+		return false
+	}
+	return true
+}
+
+// loginAllowedByStatus - Only active accounts may sign in or refresh tokens
+func loginAllowedByStatus(c *gin.Context, user *models.User) bool {
+	status, err := accountStatusService.Resolve(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account status"})
+		return false
+	}
+	if status == models.AccountStatusActive {
+		return true
+	}
+
+	response := gin.H{"error": accountStatusMessage(status), "status": status}
+	if status == models.AccountStatusSuspended && user.StatusExpiresAt != nil {
+		response["suspended_until"] = user.StatusExpiresAt
+	}
+	c.JSON(http.StatusForbidden, response)
+	return false
+}
+
+func accountStatusMessage(status string) string {
+	switch status {
+	case models.AccountStatusPending:
+		return "Your account is waiting for approval"
+	case models.AccountStatusSuspended:
+		return "Your account has been suspended"
+	case models.AccountStatusLocked:
+		return "Your account has been locked, please contact support"
+	case models.AccountStatusDeactivated:
+		return "Your account has been deactivated"
+	default:
+		return "Your account is not active"
+	}
+}
+
+// loginFailed - Count a failed attempt and respond 401, or 423 once it caused a lockout
+func loginFailed(c *gin.Context, email, message string) {
+	wait, err := services.DefaultLoginLimiter().RecordFailure(email, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionLoginFailed,
+		Outcome:    audit.OutcomeFailure,
+		ActorEmail: email,
+		Metadata:   gin.H{"reason": message, "locked": wait > 0},
+	})
+
+	if wait > 0 {
+		respondLocked(c, wait)
 		return
 	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
 
-	// Create refresh token
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, user.Role.Name)
+// respondLocked - 423 Locked with Retry-After
+func respondLocked(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusLocked, gin.H{
+		"error":       "Too many failed login attempts, please try again later",
+		"retry_after": seconds,
+	})
+}
+
+// completeLogin - Start a session for an authenticated user and respond with tokens
+func completeLogin(c *gin.Context, user *models.User) {
+	// Status may have changed since the first factor
+	if !loginAllowedByStatus(c, user) {
+		return
+	}
+
+	// Fully authenticated, forget earlier failures of this account
+	if err := services.DefaultLoginLimiter().RecordSuccess(user.Email); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+
+	// Create session with its first refresh token
+	session, refreshToken, err := sessionService.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	// Create JWT token
+	tokenString, err := utils.GenerateJWT(user.ID, user.Email, user.Role.Name, session.ID, permissionService.TokenPermissions(user.Role.Name), revocationService.IssuedAt(user.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		Metadata:   gin.H{"session_id": session.ID, "mfa": user.MFAEnabled},
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "Login successful",
 		"token":         tokenString,
 		"refresh_token": refreshToken,
 		"expires_in":    "24h",
+		"session_id":    session.ID,
 		"user": gin.H{
 			"id":    user.ID,
 			"name":  user.Name,
@@ -115,6 +308,44 @@ func Login(c *gin.Context) {
 }
 
 func Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// Body is optional, the access token alone is enough to log out
+	_ = c.ShouldBindJSON(&req)
+
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+		if claims, err := utils.ValidateAccessToken(tokenString); err == nil {
+			if err := revocationService.RevokeToken(claims); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+				return
+			}
+			if claims.SessionID != 0 {
+				if err := sessionService.Revoke(claims.UserID, claims.SessionID); err != nil && err != services.ErrSessionNotFound {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+					return
+				}
+			}
+
+			audit.Record(c, audit.Event{
+				Action:     audit.ActionLogout,
+				ActorID:    claims.UserID,
+				ActorEmail: claims.Email,
+				Metadata:   gin.H{"session_id": claims.SessionID},
+			})
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if token, err := refreshTokenService.Lookup(req.RefreshToken); err == nil {
+			if err := sessionService.RevokeFamily(token.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh token"})
+				return
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
@@ -127,16 +358,43 @@ func GetCurrentUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	permissions, err := permissionService.PermissionList(user.Role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	response := gin.H{
 		"user": gin.H{
-			"id":         user.ID,
-			"name":       user.Name,
-			"email":      user.Email,
-			"role":       user.Role.Name,
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"role":           user.Role.Name,
+			"permissions":    permissions,
+			"email_verified": user.EmailVerifiedAt != nil,
+			"status":         user.Status,
+			"created_at":     user.CreatedAt,
+			"updated_at":     user.UpdatedAt,
 		},
-	})
+	}
+
+	// Let clients show who is really signed in
+	value, _ := c.Get("claims")
+	if claims, ok := value.(*utils.Claims); ok && claims.Act != nil {
+		impersonation := gin.H{
+			"active": true,
+			"actor": gin.H{
+				"id":    claims.ActorID(),
+				"email": claims.Act.Email,
+			},
+		}
+		if claims.ExpiresAt != nil {
+			impersonation["expires_at"] = claims.ExpiresAt.Time
+		}
+		response["impersonation"] = impersonation
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // RefreshToken - Untuk refresh JWT token
@@ -150,31 +408,99 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	claims, err := utils.ValidateRefreshToken(req.RefreshToken)
+	// Consume refresh token and rotate it (single use)
+	newRefreshToken, record, err := refreshTokenService.Rotate(req.RefreshToken)
 	if err != nil {
+		if err == services.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, please login again"})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
 	// Get user from database
 	var user models.User
-	if err := config.DB.Preload("Role").First(&user, claims.UserID).Error; err != nil {
+	if err := config.DB.Preload("Role").First(&user, record.UserID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if !loginAllowedByStatus(c, &user) {
+		return
+	}
+
+	// Keep the access token bound to the session of the refresh token family
+	var sessionID uint
+	if session, err := sessionService.GetByFamily(record.FamilyID); err == nil {
+		sessionID = session.ID
+		sessionService.Touch(session.ID)
+	}
 
 	// Generate new token
-	newToken, err := utils.GenerateJWT(user.ID, user.Email, user.Role.Name)
+	newToken, err := utils.GenerateJWT(user.ID, user.Email, user.Role.Name, sessionID, permissionService.TokenPermissions(user.Role.Name), revocationService.IssuedAt(user.ID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Token refreshed successfully",
-		"token":      newToken,
-		"expires_in": "24h",
+		"message":       "Token refreshed successfully",
+		"token":         newToken,
+		"refresh_token": newRefreshToken,
+		"expires_in":    "24h",
+	})
+}
+
+// VerifyEmail - Confirm email ownership with the token from the verification link
+func VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	if req.Token == "" {
+		req.Token = c.Query("token")
+	}
+	if req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+		return
+	}
+
+	if _, err := verificationService.Verify(req.Token); err != nil {
+		switch err {
+		case services.ErrEmailAlreadyVerified:
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		case services.ErrInvalidVerificationToken:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification - Send a new verification link
+func ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid email is required"})
+		return
+	}
+
+	// Same response whether or not the email exists or is already verified
+	var user models.User
+	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err == nil {
+		if err := verificationService.SendVerification(&user); err != nil && err != services.ErrEmailAlreadyVerified {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If the email exists and is not verified yet, a verification link has been sent",
 	})
 }
 
@@ -199,22 +525,21 @@ func ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Generate reset token (in real app, you'd send email with this token)
-	resetToken, err := utils.GenerateResetToken(user.ID, user.Email)
+	// Generate reset token, older outstanding tokens become invalid
+	resetToken, err := passwordResetService.Issue(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
 		return
 	}
 
-	// In production, you would:
-	// 1. Save the reset token to database with expiration
-	// 2. Send email with reset link containing the token
-	// For now, we'll just return the token (NOT recommended for production)
+	// Token is only ever delivered by email
+	link := services.AppURL() + "/reset-password?token=" + url.QueryEscape(resetToken)
+	if err := mailer.Default().SendPasswordReset(user.Email, user.Name, link, "1 hour"); err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "Password reset token generated",
-		"reset_token": resetToken, // Remove this in production
-		"note":        "In production, this token should be sent via email",
+		"message": "If the email exists, a password reset link has been sent",
 	})
 }
 
@@ -238,33 +563,42 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Validate reset token
-	claims, err := utils.ValidateResetToken(req.ResetToken)
+	// Hash new password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired reset token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	// Additional check is no longer needed since ValidateResetToken handles it
-
-	// Get user
-	var user models.User
-	if err := config.DB.First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// Consume reset token and update password, all sessions are revoked
+	userID, err := passwordResetService.Consume(req.ResetToken, string(hashedPassword))
+	if err != nil {
+		if err == services.ErrInvalidResetToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 		return
 	}
 
-	// Update password
-	if err := config.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
-		return
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionPasswordReset,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		Metadata:   gin.H{"sessions_revoked": true},
+	})
+
+	if err := mailer.Default().SendNotification(user.Email, user.Name, "Your password was changed",
+		"The password of your account was just reset. If this was not you, please contact support immediately."); err != nil {
+		log.Printf("Failed to send password change notification to %s: %v", user.Email, err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
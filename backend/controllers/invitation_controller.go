@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InviteUser - Admin: invite an email address to register with a role
+func InviteUser(c *gin.Context) {
+	var req struct {
+		Email  string `json:"email" binding:"required,email"`
+		RoleID uint   `json:"role_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid email and role ID are required"})
+		return
+	}
+
+	var inviter models.User
+	if err := config.DB.First(&inviter, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	invitation, err := registrationService.Invite(req.Email, req.RoleID, &inviter)
+	if err != nil {
+		switch err {
+		case services.ErrEmailAlreadyRegistered:
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		case services.ErrRoleNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionInviteCreate,
+		TargetType: audit.TargetInvitation,
+		TargetID:   strconv.FormatUint(uint64(invitation.ID), 10),
+		After:      gin.H{"email": invitation.Email, "role": invitation.Role.Name, "expires_at": invitation.ExpiresAt},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Invitation sent successfully", "invitation": invitation})
+}
+
+// GetInvitations - Admin: list invitations
+func GetInvitations(c *gin.Context) {
+	invitations, err := registrationService.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// RevokeInvitation - Admin: withdraw an open invitation
+func RevokeInvitation(c *gin.Context) {
+	id, ok := parseID(c, "id", "invitation")
+	if !ok {
+		return
+	}
+
+	if err := registrationService.RevokeInvitation(id); err != nil {
+		if err == services.ErrInvitationNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Open invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionInviteRevoke,
+		TargetType: audit.TargetInvitation,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
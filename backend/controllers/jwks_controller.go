@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+
+	"backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS - Publish public signing keys so other services can verify tokens
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.Keys().JWKS())
+}
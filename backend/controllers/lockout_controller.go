@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"backend/audit"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLockouts - Admin: accounts and client IPs currently locked out of login
+func GetLockouts(c *gin.Context) {
+	lockouts, err := services.DefaultLoginLimiter().ListLocked()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// ClearLockout - Admin: remove lockout of a key ("account:<email>" or "ip:<address>")
+func ClearLockout(c *gin.Context) {
+	key := c.Param("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lockout key is required"})
+		return
+	}
+
+	if err := services.DefaultLoginLimiter().Clear(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionLockoutClear,
+		TargetType: audit.TargetLockout,
+		TargetID:   key,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared successfully"})
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var mfaService = services.NewMFAService()
+
+// GetMFAStatus - Two-factor status of the current user
+func GetMFAStatus(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_enabled":              user.MFAEnabled,
+		"recovery_codes_remaining": mfaService.RemainingRecoveryCodes(user.ID),
+	})
+}
+
+// SetupTOTP - Start TOTP enrollment, returns secret and otpauth URI (QR payload)
+func SetupTOTP(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	secret, uri, err := mfaService.BeginTOTPEnrollment(&user)
+	if err != nil {
+		if err == services.ErrMFAAlreadyEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scan the QR code with your authenticator app, then confirm with a code",
+		"secret":      secret,
+		"otpauth_url": uri,
+		"qr_payload":  uri,
+	})
+}
+
+// ConfirmTOTP - Finish enrollment with a valid code, returns recovery codes once
+func ConfirmTOTP(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	codes, err := mfaService.ConfirmTOTPEnrollment(&user, req.Code)
+	if err != nil {
+		switch err {
+		case services.ErrMFAAlreadyEnabled:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case services.ErrMFANotEnrolled, services.ErrInvalidMFACode:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+		"note":           "Store these recovery codes safely, they will not be shown again",
+	})
+}
+
+// RegenerateRecoveryCodes - Replace recovery codes, requires a current TOTP code
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := mfaService.VerifyTOTP(&user, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := mfaService.RegenerateRecoveryCodes(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA - Turn off two-factor authentication, requires password and a code
+func DisableMFA(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password and code are required"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := mfaService.VerifyTOTP(&user, req.Code); err != nil {
+		if mfaService.UseRecoveryCode(&user, req.Code) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := mfaService.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionMFADisable,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Before:     gin.H{"mfa_enabled": user.MFAEnabled},
+		After:      gin.H{"mfa_enabled": false},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyMFA - Second login step: exchange MFA token + code (or recovery code) for tokens
+func VerifyMFA(c *gin.Context) {
+	var req struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA token and code or recovery code are required"})
+		return
+	}
+
+	claims, err := utils.ValidateMFAToken(req.MFAToken)
+	if err != nil || revocationService.IsRevoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Preload("Role").First(&user, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	// Code guesses count towards the same lockout as passwords
+	if wait, err := services.DefaultLoginLimiter().Check(user.Email, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	} else if wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
+
+	// MFA token is single use. Consumed before the code is checked so that
+	// concurrent requests cannot try several codes with it, a wrong code
+	// means logging in again.
+	if err := revocationService.ConsumeToken(claims); err != nil {
+		if errors.Is(err, services.ErrTokenUsed) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify MFA token"})
+		return
+	}
+
+	if req.Code != "" {
+		err = mfaService.VerifyTOTP(&user, req.Code)
+	} else {
+		err = mfaService.UseRecoveryCode(&user, req.RecoveryCode)
+	}
+	if err != nil {
+		loginFailed(c, user.Email, err.Error())
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// ResetUserMFA - Admin: disable two-factor for a user who lost their device
+func ResetUserMFA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := mfaService.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionUserMFAReset,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Before:     gin.H{"mfa_enabled": user.MFAEnabled},
+		After:      gin.H{"mfa_enabled": false},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"backend/audit"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthError - Error response of the token endpoint (RFC 6749 section 5.2)
+func oauthError(c *gin.Context, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// IssueOAuthToken - OAuth2 token endpoint for service accounts, only the
+// client_credentials grant. Form body: grant_type, scope (optional, space
+// separated permissions) and client_id/client_secret, or HTTP Basic auth.
+// No refresh token is issued, clients request a new token when it expires.
+func IssueOAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	switch c.PostForm("grant_type") {
+	case "client_credentials":
+	case "":
+		oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Only client_credentials is supported")
+		return
+	}
+
+	clientID, clientSecret, basic := c.Request.BasicAuth()
+	if basic {
+		// Credentials in the Authorization header are form-encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client credentials are required")
+		return
+	}
+
+	account, err := serviceAccountService.Authenticate(clientID, clientSecret)
+	if err != nil {
+		if account != nil {
+			audit.Record(c, audit.Event{
+				Action:           audit.ActionServiceAccountFailed,
+				Outcome:          audit.OutcomeFailure,
+				TargetType:       audit.TargetServiceAccount,
+				TargetID:         strconv.FormatUint(uint64(account.ID), 10),
+				ServiceAccountID: account.ID,
+				Metadata:         map[string]interface{}{"client_id": clientID, "reason": err.Error()},
+			})
+		}
+		if errors.Is(err, services.ErrInvalidClientCredentials) || errors.Is(err, services.ErrServiceAccountDisabled) {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+		return
+	}
+
+	token, expiresAt, scope, err := serviceAccountService.IssueToken(account, c.PostForm("scope"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:           audit.ActionServiceAccountToken,
+		TargetType:       audit.TargetServiceAccount,
+		TargetID:         strconv.FormatUint(uint64(account.ID), 10),
+		ServiceAccountID: account.ID,
+		Metadata:         map[string]interface{}{"client_id": account.ClientID, "scope": scope},
+	})
+
+	response := gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Until(expiresAt).Seconds()),
+	}
+	if scope != "" {
+		response["scope"] = scope
+	}
+	c.JSON(http.StatusOK, response)
+}
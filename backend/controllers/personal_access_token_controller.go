@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/audit"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var personalAccessTokenService = services.NewPersonalAccessTokenService()
+
+// personalAccessTokenView - Token as shown to its owner, never the secret
+func personalAccessTokenView(token *models.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       services.TokenScopes(token),
+		"created_at":   token.CreatedAt,
+		"expires_at":   token.ExpiresAt,
+		"expired":      !token.ExpiresAt.After(time.Now()),
+		"last_used_at": token.LastUsedAt,
+		"last_used_ip": token.LastUsedIP,
+	}
+}
+
+// GetPersonalAccessTokens - List personal access tokens of the current user
+func GetPersonalAccessTokens(c *gin.Context) {
+	tokens, err := personalAccessTokenService.List(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		result = append(result, personalAccessTokenView(&tokens[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": result})
+}
+
+// CreatePersonalAccessToken - Create a token for scripts and CI.
+// Body: {name, scopes (permission names), expires_at (RFC 3339, default 30 days)}
+func CreatePersonalAccessToken(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token name is required", "details": err.Error()})
+		return
+	}
+
+	user, err := userService.GetUserByID(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	raw, token, err := personalAccessTokenService.Create(user, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTokenNameRequired),
+			errors.Is(err, services.ErrInvalidTokenExpiry),
+			errors.Is(err, services.ErrScopeNotGranted):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTooManyTokens):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionTokenCreate,
+		TargetType: audit.TargetToken,
+		TargetID:   strconv.FormatUint(uint64(token.ID), 10),
+		Metadata: map[string]interface{}{
+			"name":       token.Name,
+			"prefix":     token.Prefix,
+			"scopes":     services.TokenScopes(token),
+			"expires_at": token.ExpiresAt,
+		},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Token created, copy it now, it will not be shown again",
+		"token":   raw,
+		"details": personalAccessTokenView(token),
+	})
+}
+
+// RevokePersonalAccessToken - Revoke one token of the current user
+func RevokePersonalAccessToken(c *gin.Context) {
+	id, ok := parseID(c, "id", "token")
+	if !ok {
+		return
+	}
+
+	token, err := personalAccessTokenService.Revoke(c.GetUint("userID"), id)
+	if err != nil {
+		if errors.Is(err, services.ErrPersonalAccessTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionTokenRevoke,
+		TargetType: audit.TargetToken,
+		TargetID:   strconv.FormatUint(uint64(token.ID), 10),
+		Metadata:   map[string]interface{}{"name": token.Name, "prefix": token.Prefix},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/validators"
+
+	"github.com/gin-gonic/gin"
+)
+
+var roleService = services.NewRoleService()
+
+// roleView - Role with its directly granted permission names and number of users
+func roleView(role models.Role, userCount int64) gin.H {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, rp := range role.Permissions {
+		permissions = append(permissions, rp.Permission.Name)
+	}
+
+	return gin.H{
+		"id":          role.ID,
+		"name":        role.Name,
+		"parent_id":   role.ParentID,
+		"permissions": permissions,
+		"user_count":  userCount,
+		"created_at":  role.CreatedAt,
+		"updated_at":  role.UpdatedAt,
+	}
+}
+
+// respondRoleError - Map role service errors to HTTP responses
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch err {
+	case services.ErrRoleNotFound, services.ErrPermissionNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case services.ErrRoleNameTaken, services.ErrPermissionNameTaken, services.ErrRoleInUse,
+		services.ErrLastAdminRole, services.ErrPermissionBuiltin:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case services.ErrInvalidReassignRole, services.ErrRoleCycle:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// parseID - Read a numeric path parameter
+func parseID(c *gin.Context, param, what string) (uint, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + what + " ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetRoles - Admin: list roles with their permissions
+func GetRoles(c *gin.Context) {
+	roles, userCounts, err := roleService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, roleView(role, userCounts[role.ID]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": result})
+}
+
+// GetRole - Admin: one role with its permissions
+func GetRole(c *gin.Context) {
+	id, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+
+	role, err := roleService.GetRole(id)
+	if err != nil {
+		respondRoleError(c, err, "Failed to fetch role")
+		return
+	}
+
+	userCount, err := roleService.CountUsers(role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": roleView(*role, userCount)})
+}
+
+// CreateRole - Admin: create a role, optionally with parent and permissions
+func CreateRole(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		ParentID    *uint    `json:"parent_id"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required"})
+		return
+	}
+
+	if !validators.ValidateRoleName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Role name must be 2-50 lowercase letters, digits, '_' or '-'",
+		})
+		return
+	}
+
+	role, err := roleService.CreateRole(req.Name, req.ParentID, req.Permissions)
+	if err != nil {
+		respondRoleError(c, err, "Failed to create role")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleCreate,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(role.ID), 10),
+		After:      roleAuditView(role),
+		Metadata:   gin.H{"permissions": req.Permissions},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Role created successfully", "role": roleView(*role, 0)})
+}
+
+// UpdateRole - Admin: rename a role
+func UpdateRole(c *gin.Context) {
+	id, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required"})
+		return
+	}
+
+	if !validators.ValidateRoleName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Role name must be 2-50 lowercase letters, digits, '_' or '-'",
+		})
+		return
+	}
+
+	before, _ := roleService.GetRole(id)
+	role, err := roleService.RenameRole(id, req.Name)
+	if err != nil {
+		respondRoleError(c, err, "Failed to update role")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleUpdate,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(role.ID), 10),
+		Before:     roleAuditView(before),
+		After:      roleAuditView(role),
+	})
+
+	userCount, _ := roleService.CountUsers(role.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully", "role": roleView(*role, userCount)})
+}
+
+// SetRoleParent - Admin: set the role whose permissions are inherited,
+// {"parent_id": null} removes the parent
+func SetRoleParent(c *gin.Context) {
+	id, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, _ := roleService.GetRole(id)
+	role, err := roleService.SetParent(id, req.ParentID)
+	if err != nil {
+		respondRoleError(c, err, "Failed to update role parent")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleUpdate,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(role.ID), 10),
+		Before:     roleAuditView(before),
+		After:      roleAuditView(role),
+	})
+
+	userCount, _ := roleService.CountUsers(role.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Role parent updated successfully", "role": roleView(*role, userCount)})
+}
+
+// GetEffectivePermissions - Admin: all permissions of a role including
+// inherited ones, with the role granting each of them
+func GetEffectivePermissions(c *gin.Context) {
+	id, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+
+	permissions, err := roleService.EffectivePermissions(id)
+	if err != nil {
+		respondRoleError(c, err, "Failed to resolve permissions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role_id": id, "permissions": permissions})
+}
+
+// DeleteRole - Admin: delete a role. Users and service accounts of the role are
+// moved to the role given in ?reassign_to=<role id>, child roles move up to its parent.
+func DeleteRole(c *gin.Context) {
+	id, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+
+	var reassignTo uint
+	if value := c.Query("reassign_to"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to role ID"})
+			return
+		}
+		reassignTo = uint(parsed)
+	}
+
+	before, _ := roleService.GetRole(id)
+	if err := roleService.DeleteRole(id, reassignTo); err != nil {
+		respondRoleError(c, err, "Failed to delete role")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleDelete,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     roleAuditView(before),
+		Metadata:   gin.H{"reassign_to": reassignTo},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// AttachRolePermission - Admin: grant a permission to a role
+func AttachRolePermission(c *gin.Context) {
+	roleID, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+	permissionID, ok := parseID(c, "permissionId", "permission")
+	if !ok {
+		return
+	}
+
+	if err := roleService.AttachPermission(roleID, permissionID); err != nil {
+		respondRoleError(c, err, "Failed to attach permission")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleGrant,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(roleID), 10),
+		Metadata:   gin.H{"permission_id": permissionID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission attached successfully"})
+}
+
+// DetachRolePermission - Admin: take a permission away from a role
+func DetachRolePermission(c *gin.Context) {
+	roleID, ok := parseID(c, "id", "role")
+	if !ok {
+		return
+	}
+	permissionID, ok := parseID(c, "permissionId", "permission")
+	if !ok {
+		return
+	}
+
+	if err := roleService.DetachPermission(roleID, permissionID); err != nil {
+		respondRoleError(c, err, "Failed to detach permission")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleRevoke,
+		TargetType: audit.TargetRole,
+		TargetID:   strconv.FormatUint(uint64(roleID), 10),
+		Metadata:   gin.H{"permission_id": permissionID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission detached successfully"})
+}
+
+// GetPermissions - Admin: list all permissions
+func GetPermissions(c *gin.Context) {
+	permissions, err := roleService.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// CreatePermission - Admin: create a custom permission
+func CreatePermission(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission name is required"})
+		return
+	}
+
+	if !validators.ValidatePermissionName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission name must look like 'resource:action'"})
+		return
+	}
+
+	permission, err := roleService.CreatePermission(req.Name, req.Description)
+	if err != nil {
+		respondRoleError(c, err, "Failed to create permission")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionPermCreate,
+		TargetType: audit.TargetPermission,
+		TargetID:   strconv.FormatUint(uint64(permission.ID), 10),
+		After:      gin.H{"name": permission.Name, "description": permission.Description},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Permission created successfully", "permission": permission})
+}
+
+// UpdatePermission - Admin: change the description of a permission
+func UpdatePermission(c *gin.Context) {
+	id, ok := parseID(c, "id", "permission")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var before models.Permission
+	config.DB.First(&before, id)
+	permission, err := roleService.UpdatePermission(id, req.Description)
+	if err != nil {
+		respondRoleError(c, err, "Failed to update permission")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionPermUpdate,
+		TargetType: audit.TargetPermission,
+		TargetID:   strconv.FormatUint(uint64(permission.ID), 10),
+		Before:     gin.H{"description": before.Description},
+		After:      gin.H{"description": permission.Description},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission updated successfully", "permission": permission})
+}
+
+// DeletePermission - Admin: delete a custom permission
+func DeletePermission(c *gin.Context) {
+	id, ok := parseID(c, "id", "permission")
+	if !ok {
+		return
+	}
+
+	var before models.Permission
+	config.DB.First(&before, id)
+	if err := roleService.DeletePermission(id); err != nil {
+		respondRoleError(c, err, "Failed to delete permission")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionPermDelete,
+		TargetType: audit.TargetPermission,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     gin.H{"name": before.Name, "description": before.Description},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission deleted successfully"})
+}
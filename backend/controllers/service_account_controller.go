@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/audit"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var serviceAccountService = services.NewServiceAccountService()
+
+// serviceAccountView - Service account as shown to admins, never secrets
+func serviceAccountView(account *models.ServiceAccount) gin.H {
+	secrets := make([]gin.H, 0, len(account.Secrets))
+	for _, secret := range account.Secrets {
+		secrets = append(secrets, serviceAccountSecretView(&secret))
+	}
+
+	return gin.H{
+		"id":           account.ID,
+		"name":         account.Name,
+		"description":  account.Description,
+		"client_id":    account.ClientID,
+		"owner":        gin.H{"id": account.Owner.ID, "name": account.Owner.Name, "email": account.Owner.Email},
+		"role":         gin.H{"id": account.Role.ID, "name": account.Role.Name},
+		"disabled":     account.DisabledAt != nil,
+		"disabled_at":  account.DisabledAt,
+		"last_used_at": account.LastUsedAt,
+		"created_at":   account.CreatedAt,
+		"secrets":      secrets,
+	}
+}
+
+func serviceAccountSecretView(secret *models.ServiceAccountSecret) gin.H {
+	return gin.H{
+		"id":           secret.ID,
+		"prefix":       secret.Prefix,
+		"created_at":   secret.CreatedAt,
+		"expires_at":   secret.ExpiresAt,
+		"last_used_at": secret.LastUsedAt,
+	}
+}
+
+// serviceAccountAuditView - Service account fields recorded in audit diffs
+func serviceAccountAuditView(account *models.ServiceAccount) gin.H {
+	return gin.H{
+		"name":        account.Name,
+		"description": account.Description,
+		"client_id":   account.ClientID,
+		"owner_id":    account.OwnerID,
+		"role":        account.Role.Name,
+		"disabled":    account.DisabledAt != nil,
+	}
+}
+
+// respondServiceAccountError - Map service account errors to responses
+func respondServiceAccountError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+	case errors.Is(err, services.ErrSecretNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Secret not found"})
+	case errors.Is(err, services.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, services.ErrRoleExceedsCaller):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrServiceAccountNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrServiceAccountNameRequired),
+		errors.Is(err, services.ErrServiceAccountOwner),
+		errors.Is(err, services.ErrInvalidSecretOverlap):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetServiceAccounts - Admin: list service accounts
+func GetServiceAccounts(c *gin.Context) {
+	accounts, err := serviceAccountService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(accounts))
+	for i := range accounts {
+		view := serviceAccountView(&accounts[i])
+		delete(view, "secrets")
+		result = append(result, view)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_accounts": result})
+}
+
+// GetServiceAccount - Admin: one service account with its usable secrets
+func GetServiceAccount(c *gin.Context) {
+	id, ok := parseID(c, "id", "service account")
+	if !ok {
+		return
+	}
+
+	account, err := serviceAccountService.Get(id)
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to fetch service account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_account": serviceAccountView(account)})
+}
+
+// CreateServiceAccount - Admin: create a service account owned by the caller.
+// Body: {name, description, role_id}. The client secret is only shown here.
+func CreateServiceAccount(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		RoleID      uint   `json:"role_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and role ID are required", "details": err.Error()})
+		return
+	}
+
+	account, secret, err := serviceAccountService.Create(req.Name, req.Description, c.GetUint("userID"), req.RoleID, c.GetString("userRole"))
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to create service account")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountCreate,
+		TargetType: audit.TargetServiceAccount,
+		TargetID:   strconv.FormatUint(uint64(account.ID), 10),
+		After:      serviceAccountAuditView(account),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Service account created, copy the client secret now, it will not be shown again",
+		"service_account": serviceAccountView(account),
+		"client_id":       account.ClientID,
+		"client_secret":   secret,
+	})
+}
+
+// UpdateServiceAccount - Admin: change a service account.
+// Body: {description, role_id, owner_id, disabled}, all optional
+func UpdateServiceAccount(c *gin.Context) {
+	id, ok := parseID(c, "id", "service account")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Description *string `json:"description"`
+		RoleID      *uint   `json:"role_id"`
+		OwnerID     *uint   `json:"owner_id"`
+		Disabled    *bool   `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	before, err := serviceAccountService.Get(id)
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to update service account")
+		return
+	}
+
+	account, err := serviceAccountService.Update(id, services.ServiceAccountUpdate{
+		Description: req.Description,
+		RoleID:      req.RoleID,
+		OwnerID:     req.OwnerID,
+		Disabled:    req.Disabled,
+	}, c.GetString("userRole"))
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to update service account")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountUpdate,
+		TargetType: audit.TargetServiceAccount,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     serviceAccountAuditView(before),
+		After:      serviceAccountAuditView(account),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account updated successfully", "service_account": serviceAccountView(account)})
+}
+
+// DeleteServiceAccount - Admin: delete a service account, its tokens stop working
+func DeleteServiceAccount(c *gin.Context) {
+	id, ok := parseID(c, "id", "service account")
+	if !ok {
+		return
+	}
+
+	before, err := serviceAccountService.Get(id)
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to delete service account")
+		return
+	}
+
+	if err := serviceAccountService.Delete(id); err != nil {
+		respondServiceAccountError(c, err, "Failed to delete service account")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountDelete,
+		TargetType: audit.TargetServiceAccount,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     serviceAccountAuditView(before),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted successfully"})
+}
+
+// RotateServiceAccountSecret - Admin: issue a new client secret. Previous
+// secrets keep working for overlap_hours (default 24, max 168, 0 = now).
+// The new secret is only shown here.
+func RotateServiceAccountSecret(c *gin.Context) {
+	id, ok := parseID(c, "id", "service account")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		OverlapHours *int `json:"overlap_hours"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+	}
+
+	overlap := services.DefaultSecretRotationOverlap
+	if req.OverlapHours != nil {
+		overlap = time.Duration(*req.OverlapHours) * time.Hour
+	}
+
+	raw, secret, err := serviceAccountService.RotateSecret(id, overlap)
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to rotate secret")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountRotate,
+		TargetType: audit.TargetServiceAccount,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Metadata:   map[string]interface{}{"prefix": secret.Prefix, "overlap": overlap.String()},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":                "Secret rotated, copy it now, it will not be shown again",
+		"client_secret":          raw,
+		"secret":                 serviceAccountSecretView(secret),
+		"previous_secrets_until": time.Now().Add(overlap),
+	})
+}
+
+// RevokeServiceAccountSecret - Admin: end one client secret now
+func RevokeServiceAccountSecret(c *gin.Context) {
+	id, ok := parseID(c, "id", "service account")
+	if !ok {
+		return
+	}
+	secretID, ok := parseID(c, "secretId", "secret")
+	if !ok {
+		return
+	}
+
+	secret, err := serviceAccountService.RevokeSecret(id, secretID)
+	if err != nil {
+		respondServiceAccountError(c, err, "Failed to revoke secret")
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountRevoke,
+		TargetType: audit.TargetServiceAccount,
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Metadata:   map[string]interface{}{"prefix": secret.Prefix},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Secret revoked successfully"})
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionView - Session as shown to its owner
+func sessionView(session models.Session, currentSessionID uint) gin.H {
+	return gin.H{
+		"id":           session.ID,
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"created_at":   session.CreatedAt,
+		"last_seen_at": session.LastSeenAt,
+		"current":      session.ID == currentSessionID,
+	}
+}
+
+// GetSessions - List active sessions (devices) of the current user
+func GetSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	currentSessionID := c.GetUint("sessionID")
+
+	sessions, err := sessionService.ListActive(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionView(session, currentSessionID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+// RevokeSession - Sign out one device of the current user
+func RevokeSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := sessionService.Revoke(userID, uint(id)); err != nil {
+		if err == services.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions - Sign out every device except the current one
+func RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	currentSessionID := c.GetUint("sessionID")
+
+	count, err := sessionService.RevokeOthers(userID, currentSessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions revoked successfully",
+		"revoked": count,
+	})
+}
@@ -1,10 +1,14 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 
 	"backend/config"
 	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"backend/validators"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -31,51 +35,101 @@ func GetUserProfile(c *gin.Context) {
 	})
 }
 
+// UpdateUserProfile - Partial update of the own profile (JSON Merge Patch),
+// only name and password can be changed. A password change needs
+// current_password and signs out every other session and token, the current
+// session stays signed in with the new access token in the response.
 func UpdateUserProfile(c *gin.Context) {
 	userID := c.GetUint("userID")
 
 	var user models.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
+	if err := config.DB.Preload("Role").First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	req, valid := validators.ValidateUpdateProfileRequest(c)
+	if !valid {
+		return // Error response sudah dikirim di validator
 	}
 
-	// Remove sensitive fields that users shouldn't be able to update
-	delete(updateData, "role_id")
-	delete(updateData, "email") // Email changes might need verification
-
-	// Handle password update separately for security
-	if password, exists := updateData["password"]; exists {
-		if passwordStr, ok := password.(string); ok && passwordStr != "" {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordStr), bcrypt.DefaultCost)
+	updateData := map[string]interface{}{}
+	if req.Name != nil {
+		updateData["name"] = *req.Name
+	}
+	if req.Password != nil {
+		// A stolen access token alone must not be enough to take over the
+		// account, and guesses count towards the login lockout
+		limiter := services.DefaultLoginLimiter()
+		if wait, err := limiter.Check(user.Email, c.ClientIP()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+			return
+		} else if wait > 0 {
+			respondLocked(c, wait)
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(*req.CurrentPassword)); err != nil {
+			wait, err := limiter.RecordFailure(user.Email, c.ClientIP())
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+				log.Printf("Failed to record login failure: %v", err)
+			}
+			if wait > 0 {
+				respondLocked(c, wait)
 				return
 			}
-			updateData["password"] = string(hashedPassword)
-		} else {
-			delete(updateData, "password")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
 		}
+		updateData["password"] = string(hashedPassword)
 	}
 
-	if err := config.DB.Model(&user).Updates(updateData).Error; err != nil {
+	sessionID := c.GetUint("sessionID")
+	if err := userService.UpdateProfile(&user, updateData, sessionID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+	if req.Password == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+		return
+	}
+
+	response := gin.H{"message": "Password changed, other sessions have been signed out"}
+	if sessionID != 0 {
+		// The access token of this request was revoked with the others
+		token, err := utils.GenerateJWT(user.ID, user.Email, user.Role.Name, sessionID, permissionService.TokenPermissions(user.Role.Name), revocationService.IssuedAt(user.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but failed to create a new token, please log in again"})
+			return
+		}
+		response["token"] = token
+		response["expires_in"] = "24h"
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func GetUserDashboard(c *gin.Context) {
 	userID := c.GetUint("userID")
 	userEmail := c.GetString("userEmail")
 	userRole := c.GetString("userRole")
+	currentSessionID := c.GetUint("sessionID")
+
+	sessions, err := sessionService.ListActive(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	activeSessions := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		activeSessions = append(activeSessions, sessionView(session, currentSessionID))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User Dashboard",
@@ -83,6 +137,7 @@ func GetUserDashboard(c *gin.Context) {
 			"user_id":         userID,
 			"user_email":      userEmail,
 			"user_role":       userRole,
+			"sessions":        activeSessions,
 			"welcome_message": "Welcome to your personal dashboard!",
 		},
 	})
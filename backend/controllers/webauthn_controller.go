@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"backend/webauthn"
+
+	"github.com/gin-gonic/gin"
+)
+
+var webAuthnService = services.NewWebAuthnService()
+
+// BeginPasskeyRegistration - Creation options for registering a passkey
+func BeginPasskeyRegistration(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ceremonyID, options, err := webAuthnService.BeginRegistration(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"publicKey":   options,
+	})
+}
+
+// FinishPasskeyRegistration - Verify attestation and store the passkey
+func FinishPasskeyRegistration(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req struct {
+		CeremonyID string                         `json:"ceremony_id" binding:"required"`
+		Name       string                         `json:"name"`
+		Credential *webauthn.RegistrationResponse `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ceremony ID and credential are required"})
+		return
+	}
+
+	credential, err := webAuthnService.FinishRegistration(userID, req.CeremonyID, req.Name, req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Passkey registered successfully",
+		"passkey": credential,
+	})
+}
+
+// BeginPasskeyLogin - Request options for passwordless login. The login is
+// always discoverable, the authenticator offers its passkeys: listing the
+// passkeys of an email would reveal whether the account exists.
+func BeginPasskeyLogin(c *gin.Context) {
+	ceremonyID, options, err := webAuthnService.BeginLogin(0, services.CeremonyLogin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"publicKey":   options,
+	})
+}
+
+// FinishPasskeyLogin - Verify assertion and issue the same tokens as Login.
+// A passkey only replaces password and second factor when the authenticator
+// verified the user. With presence alone it counts as the first factor: users
+// with MFA get the usual MFA challenge, other users are rejected.
+func FinishPasskeyLogin(c *gin.Context) {
+	var req struct {
+		CeremonyID string                      `json:"ceremony_id" binding:"required"`
+		Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ceremony ID and credential are required"})
+		return
+	}
+
+	userID, userVerified, err := webAuthnService.FinishLogin(req.CeremonyID, services.CeremonyLogin, req.Credential)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey authentication failed"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey authentication failed"})
+		return
+	}
+
+	if !loginAllowedByVerification(c, &user) {
+		return
+	}
+
+	if !userVerified {
+		if !user.MFAEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login requires user verification (PIN or biometric)"})
+			return
+		}
+		if !loginAllowedByStatus(c, &user) {
+			return
+		}
+		// The same passkey cannot also be the second factor
+		respondMFAChallenge(c, &user, false)
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// BeginPasskeyMFA - Request options for using a passkey as second factor
+func BeginPasskeyMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA token is required"})
+		return
+	}
+
+	claims, err := utils.ValidateMFAToken(req.MFAToken)
+	if err != nil || revocationService.IsRevoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	if !webAuthnService.HasCredentials(claims.UserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkey registered"})
+		return
+	}
+
+	ceremonyID, options, err := webAuthnService.BeginLogin(claims.UserID, services.CeremonyMFA)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"publicKey":   options,
+	})
+}
+
+// FinishPasskeyMFA - Complete the second login step with a passkey assertion
+func FinishPasskeyMFA(c *gin.Context) {
+	var req struct {
+		MFAToken   string                      `json:"mfa_token" binding:"required"`
+		CeremonyID string                      `json:"ceremony_id" binding:"required"`
+		Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA token, ceremony ID and credential are required"})
+		return
+	}
+
+	claims, err := utils.ValidateMFAToken(req.MFAToken)
+	if err != nil || revocationService.IsRevoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	userID, _, err := webAuthnService.FinishLogin(req.CeremonyID, services.CeremonyMFA, req.Credential)
+	if err != nil || userID != claims.UserID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	// MFA token is single use
+	if err := revocationService.ConsumeToken(claims); err != nil {
+		if errors.Is(err, services.ErrTokenUsed) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// GetPasskeys - List passkeys of the current user
+func GetPasskeys(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	credentials, err := webAuthnService.ListCredentials(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": credentials})
+}
+
+// DeletePasskey - Remove a passkey of the current user
+func DeletePasskey(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := webAuthnService.DeleteCredential(userID, uint(id)); err != nil {
+		if err == services.ErrCredentialNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted successfully"})
+}
@@ -0,0 +1,171 @@
+// Package mailer renders templated emails and delivers them through a pluggable transport.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Template names
+const (
+	TemplatePasswordReset = "password_reset"
+	TemplateVerifyEmail   = "verify_email"
+	TemplateNotification  = "notification"
+	TemplateInvitation    = "invitation"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+)
+
+// Mailer - Renders templates and hands messages to a transport
+type Mailer struct {
+	transport Transport
+	from      string
+	appName   string
+}
+
+func New(transport Transport, from, appName string) *Mailer {
+	return &Mailer{transport: transport, from: from, appName: appName}
+}
+
+var defaultMailer = struct {
+	once   sync.Once
+	mailer *Mailer
+}{}
+
+// Default - Mailer configured from environment:
+//
+//	MAIL_TRANSPORT  smtp, file, console or memory. Unset means console when
+//	                APP_ENV=development, otherwise every send fails.
+//	MAIL_FROM       sender address
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+//	MAIL_FILE_DIR   directory for the file transport
+func Default() *Mailer {
+	defaultMailer.once.Do(func() {
+		defaultMailer.mailer = New(transportFromEnv(), envOr("MAIL_FROM", "no-reply@localhost"), envOr("APP_NAME", "Golang Auth"))
+	})
+	return defaultMailer.mailer
+}
+
+// SetDefault - Replace the default mailer, e.g. with a MemoryTransport in tests
+func SetDefault(m *Mailer) {
+	defaultMailer.once.Do(func() {})
+	defaultMailer.mailer = m
+}
+
+func transportFromEnv() Transport {
+	switch os.Getenv("MAIL_TRANSPORT") {
+	case "smtp":
+		port, err := strconv.Atoi(envOr("SMTP_PORT", "587"))
+		if err != nil {
+			log.Fatal("Invalid SMTP_PORT:", err)
+		}
+		return NewSMTPTransport(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		return NewFileTransport(envOr("MAIL_FILE_DIR", "mail"))
+	case "memory":
+		return NewMemoryTransport()
+	case "console":
+		return NewConsoleTransport(os.Stdout)
+	case "":
+		if os.Getenv("APP_ENV") == "development" {
+			log.Println("MAIL_TRANSPORT not set, printing emails to the console (APP_ENV=development)")
+			return NewConsoleTransport(os.Stdout)
+		}
+		log.Println("MAIL_TRANSPORT not set, emails cannot be sent")
+		return UnconfiguredTransport{}
+	default:
+		log.Printf("Unknown MAIL_TRANSPORT %q, emails cannot be sent", os.Getenv("MAIL_TRANSPORT"))
+		return UnconfiguredTransport{}
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Transport - Underlying transport (e.g. to read a MemoryTransport)
+func (m *Mailer) Transport() Transport {
+	return m.transport
+}
+
+// Send - Render template with data and deliver it to one recipient
+func (m *Mailer) Send(to, subject, template string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["AppName"] = m.appName
+	data["Subject"] = subject
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, template+".txt", data); err != nil {
+		return fmt.Errorf("mailer: render %s text: %w", template, err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, template+".html", data); err != nil {
+		return fmt.Errorf("mailer: render %s html: %w", template, err)
+	}
+
+	msg := Message{
+		From:     m.from,
+		To:       []string{to},
+		Subject:  subject,
+		Text:     text.String(),
+		HTML:     html.String(),
+		Template: template,
+		Data:     data,
+	}
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	return m.transport.Send(msg)
+}
+
+// SendPasswordReset - Email with the password reset link
+func (m *Mailer) SendPasswordReset(to, name, link string, validFor string) error {
+	return m.Send(to, "Reset your password", TemplatePasswordReset, map[string]interface{}{
+		"Name":     name,
+		"Link":     link,
+		"ValidFor": validFor,
+	})
+}
+
+// SendVerification - Email with the address verification link
+func (m *Mailer) SendVerification(to, name, link string) error {
+	return m.Send(to, "Verify your email address", TemplateVerifyEmail, map[string]interface{}{
+		"Name": name,
+		"Link": link,
+	})
+}
+
+// SendInvitation - Email inviting someone to register with a given role
+func (m *Mailer) SendInvitation(to, invitedBy, role, link, validFor string) error {
+	return m.Send(to, "You have been invited to "+m.appName, TemplateInvitation, map[string]interface{}{
+		"InvitedBy": invitedBy,
+		"Role":      role,
+		"Link":      link,
+		"ValidFor":  validFor,
+	})
+}
+
+// SendNotification - Short informational email, e.g. security notices
+func (m *Mailer) SendNotification(to, name, subject, message string) error {
+	return m.Send(to, subject, TemplateNotification, map[string]interface{}{
+		"Name":    name,
+		"Message": message,
+	})
+}
@@ -0,0 +1,144 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendRendersTemplates(t *testing.T) {
+	link := "https://app.example.com/reset?token=abc&x=1"
+
+	tests := []struct {
+		name         string
+		send         func(m *Mailer) error
+		wantTemplate string
+		wantSubject  string
+		wantText     []string
+		wantHTML     []string
+	}{
+		{
+			name:         "password reset",
+			send:         func(m *Mailer) error { return m.SendPasswordReset("jane@example.com", "Jane", link, "1 hour") },
+			wantTemplate: TemplatePasswordReset,
+			wantSubject:  "Reset your password",
+			wantText:     []string{"Hi Jane,", link, "valid for 1 hour", "Test App"},
+			// html/template escapes the query string
+			wantHTML: []string{"Hi Jane,", `href="https://app.example.com/reset?token=abc&amp;x=1"`},
+		},
+		{
+			name:         "verification",
+			send:         func(m *Mailer) error { return m.SendVerification("jane@example.com", "Jane", link) },
+			wantTemplate: TemplateVerifyEmail,
+			wantSubject:  "Verify your email address",
+			wantText:     []string{"Hi Jane,", link},
+		},
+		{
+			name: "invitation",
+			send: func(m *Mailer) error {
+				return m.SendInvitation("jane@example.com", "admin@example.com", "editor", link, "7 days")
+			},
+			wantTemplate: TemplateInvitation,
+			wantSubject:  "You have been invited to Test App",
+			wantText:     []string{"admin@example.com", "editor", link},
+		},
+		{
+			name: "notification escapes HTML",
+			send: func(m *Mailer) error {
+				return m.SendNotification("jane@example.com", "<b>Jane</b>", "Security notice", "New sign-in")
+			},
+			wantTemplate: TemplateNotification,
+			wantSubject:  "Security notice",
+			wantText:     []string{"<b>Jane</b>", "New sign-in"},
+			wantHTML:     []string{"&lt;b&gt;Jane&lt;/b&gt;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewMemoryTransport()
+			m := New(transport, "no-reply@example.com", "Test App")
+			if err := tt.send(m); err != nil {
+				t.Fatal(err)
+			}
+
+			msg, ok := transport.Last()
+			if !ok {
+				t.Fatal("no message sent")
+			}
+			if msg.Template != tt.wantTemplate || msg.Subject != tt.wantSubject {
+				t.Errorf("got template %q subject %q, want %q %q", msg.Template, msg.Subject, tt.wantTemplate, tt.wantSubject)
+			}
+			if msg.From != "no-reply@example.com" || len(msg.To) != 1 || msg.To[0] != "jane@example.com" {
+				t.Errorf("got from %q to %v", msg.From, msg.To)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(msg.Text, want) {
+					t.Errorf("text does not contain %q:\n%s", want, msg.Text)
+				}
+			}
+			for _, want := range tt.wantHTML {
+				if !strings.Contains(msg.HTML, want) {
+					t.Errorf("HTML does not contain %q:\n%s", want, msg.HTML)
+				}
+			}
+			if strings.Contains(msg.HTML, "<b>Jane</b>") {
+				t.Error("HTML contains unescaped data")
+			}
+		})
+	}
+}
+
+func TestSendRejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		subject string
+	}{
+		{name: "line break in subject", from: "no-reply@example.com", to: "jane@example.com", subject: "Hi\r\nBcc: victim@example.com"},
+		{name: "newline in subject", from: "no-reply@example.com", to: "jane@example.com", subject: "Hi\nBcc: victim@example.com"},
+		{name: "header in recipient", from: "no-reply@example.com", to: "jane@example.com\r\nBcc: victim@example.com", subject: "Hi"},
+		{name: "invalid recipient", from: "no-reply@example.com", to: "jane", subject: "Hi"},
+		{name: "invalid sender", from: "no-reply", to: "jane@example.com", subject: "Hi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewMemoryTransport()
+			m := New(transport, tt.from, "Test App")
+			if err := m.SendNotification(tt.to, "Jane", tt.subject, "Hello"); err == nil {
+				t.Fatal("message was accepted")
+			}
+			if len(transport.Messages()) != 0 {
+				t.Error("invalid message reached the transport")
+			}
+		})
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	valid := Message{From: "no-reply@example.com", To: []string{"jane@example.com"}, Subject: "Hi"}
+
+	tests := []struct {
+		name    string
+		change  func(m *Message)
+		wantErr bool
+	}{
+		{name: "valid", change: func(m *Message) {}},
+		{name: "display name", change: func(m *Message) { m.To = []string{"Jane Doe <jane@example.com>"} }},
+		{name: "no recipient", change: func(m *Message) { m.To = nil }, wantErr: true},
+		{name: "second recipient invalid", change: func(m *Message) { m.To = append(m.To, "not an address") }, wantErr: true},
+		{name: "carriage return in subject", change: func(m *Message) { m.Subject = "Hi\rthere" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := valid
+			msg.To = append([]string{}, valid.To...)
+			tt.change(&msg)
+			if err := msg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
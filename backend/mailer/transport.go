@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Transport - Delivers a rendered message
+type Transport interface {
+	Send(msg Message) error
+}
+
+// ErrNoTransport - Returned by every send when no transport is configured
+var ErrNoTransport = errors.New("mailer: no transport configured, set MAIL_TRANSPORT")
+
+// UnconfiguredTransport - Fails every send, so that reset and verification
+// links are neither dropped silently nor printed to production logs
+type UnconfiguredTransport struct{}
+
+func (UnconfiguredTransport) Send(msg Message) error {
+	return ErrNoTransport
+}
+
+// SMTPTransport - Deliver through an SMTP server (STARTTLS is used when offered)
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	return &SMTPTransport{Host: host, Port: port, Username: username, Password: password}
+}
+
+func (t *SMTPTransport) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	return smtp.SendMail(addr, auth, msg.From, msg.To, data)
+}
+
+// FileTransport - Development driver writing every message as an .eml file
+type FileTransport struct {
+	Dir string
+}
+
+func NewFileTransport(dir string) *FileTransport {
+	return &FileTransport{Dir: dir}
+}
+
+func (t *FileTransport) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), msg.Template)
+	return os.WriteFile(filepath.Join(t.Dir, name), data, 0o600)
+}
+
+// ConsoleTransport - Development driver printing the text part of every message
+type ConsoleTransport struct {
+	mu  sync.Mutex
+	Out io.Writer
+}
+
+func NewConsoleTransport(out io.Writer) *ConsoleTransport {
+	return &ConsoleTransport{Out: out}
+}
+
+func (t *ConsoleTransport) Send(msg Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := fmt.Fprintf(t.Out, "----- email -----\nFrom: %s\nTo: %v\nSubject: %s\n\n%s\n-----------------\n",
+		msg.From, msg.To, msg.Subject, msg.Text)
+	return err
+}
+
+// MemoryTransport - Captures messages instead of sending them, for tests
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(msg Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, msg)
+	return nil
+}
+
+// Messages - Copy of every captured message
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message(nil), t.messages...)
+}
+
+// Last - Most recent captured message
+func (t *MemoryTransport) Last() (Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.messages) == 0 {
+		return Message{}, false
+	}
+	return t.messages[len(t.messages)-1], true
+}
+
+// Reset - Drop captured messages
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
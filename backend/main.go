@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,6 +13,7 @@ import (
 	// Local imports
 	"backend/config"
 	"backend/routes"
+	"backend/services"
 )
 
 func main() {
@@ -22,15 +25,28 @@ func main() {
 	// Initialize database
 	config.InitDatabase()
 
+	// Load revoked tokens into memory and keep them in sync
+	services.NewRevocationService().LoadRevocations(time.Minute)
+	services.NewPasswordResetService().StartCleanup(time.Hour)
+	services.NewWebAuthnService().StartCleanup(time.Hour)
+	services.NewUserService().StartRetentionPurge(time.Hour)
+	services.NewAccountStatusService().StartExpirySweep(time.Minute)
+
 	// Initialize Gin router
 	r := gin.Default()
 
+	// Only trust X-Forwarded-For from known proxies, otherwise any client could
+	// pick the IP that login lockouts and rate limits are counted against
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
@@ -45,3 +61,15 @@ func main() {
 	log.Printf("Server running on port %s", port)
 	r.Run(":" + port)
 }
+
+// trustedProxies - TRUSTED_PROXIES, comma separated IPs or CIDRs of reverse
+// proxies in front of the API. Empty means none, ClientIP is the peer address.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
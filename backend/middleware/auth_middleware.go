@@ -1,14 +1,48 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"slices"
 	"strings"
 
+	"backend/audit"
+	"backend/models"
+	"backend/services"
 	"backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	revocationService                                     = services.NewRevocationService()
+	sessionService                                        = services.NewSessionService()
+	permissionService          permissionChecker          = services.NewPermissionService()
+	accountStatusService       accountStatusChecker       = services.NewAccountStatusService()
+	personalAccessTokenService personalAccessTokenChecker = services.NewPersonalAccessTokenService()
+	serviceAccountService      serviceAccountChecker      = services.NewServiceAccountService()
+)
+
+// Lookups made on every request, replaced by fakes in tests
+
+type permissionChecker interface {
+	HasPermission(role string, permissions ...string) (bool, error)
+}
+
+type accountStatusChecker interface {
+	Status(userID uint) (string, error)
+	Role(userID uint) (string, error)
+}
+
+type personalAccessTokenChecker interface {
+	Authenticate(raw string) (*models.PersonalAccessToken, error)
+	Touch(tokenID uint, ipAddress string)
+}
+
+type serviceAccountChecker interface {
+	Role(id uint) (string, error)
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -20,16 +54,198 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
-		claims, err := utils.ValidateJWT(tokenString)
+		if strings.HasPrefix(tokenString, utils.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, tokenString)
+			return
+		}
+
+		claims, err := utils.ValidateAccessToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		if revocationService.IsRevoked(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		if claims.ServiceAccountID != 0 {
+			authenticateServiceAccount(c, claims)
+			return
+		}
+
+		if !requireActiveAccount(c, claims.UserID) {
+			return
+		}
+
+		// The current role, not the one signed into the token
+		role, err := accountStatusService.Role(claims.UserID)
+		if err != nil {
+			log.Printf("Failed to resolve role: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+
+		// Impersonation token: the admin holding it must still be active
+		impersonatorID := claims.ActorID()
+		if claims.Act != nil {
+			actorStatus, err := accountStatusService.Status(impersonatorID)
+			if impersonatorID == 0 || err != nil || actorStatus != models.AccountStatusActive {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer valid"})
+				c.Abort()
+				return
+			}
+			c.Set("impersonatorID", impersonatorID)
+			c.Set("impersonatorEmail", claims.Act.Email)
+		}
+
+		sessionService.Touch(claims.SessionID)
+
+		c.Set("claims", claims)
+		c.Set("sessionID", claims.SessionID)
 		c.Set("userID", claims.UserID)
 		c.Set("userEmail", claims.Email)
-		c.Set("userRole", claims.Role)
+		c.Set("userRole", role)
+		c.Next()
+
+		// Every request made while impersonating ends up in the audit trail
+		if impersonatorID != 0 {
+			outcome := audit.OutcomeSuccess
+			if c.Writer.Status() >= http.StatusBadRequest {
+				outcome = audit.OutcomeFailure
+			}
+			audit.Record(c, audit.Event{
+				Action:  audit.ActionImpersonated,
+				Outcome: outcome,
+				Metadata: map[string]interface{}{
+					"method": c.Request.Method,
+					"path":   c.Request.URL.Path,
+					"status": c.Writer.Status(),
+				},
+			})
+		}
+	}
+}
+
+// requireActiveAccount - Abort unless the account may use its tokens.
+// Suspending or locking revokes tokens too, this also covers changes made
+// directly in the database (cached, see AccountStatusCacheTTL).
+func requireActiveAccount(c *gin.Context, userID uint) bool {
+	status, err := accountStatusService.Status(userID)
+	if err == services.ErrUserNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to check account status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account status"})
+		c.Abort()
+		return false
+	}
+	if status != models.AccountStatusActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active", "status": status})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// authenticatePersonalAccessToken - AuthMiddleware for "pat_" tokens. The
+// token's scopes are kept in the context for RequirePermission.
+func authenticatePersonalAccessToken(c *gin.Context, raw string) {
+	token, err := personalAccessTokenService.Authenticate(raw)
+	if err == services.ErrPersonalAccessTokenInvalid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to check personal access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+		c.Abort()
+		return
+	}
+
+	if !requireActiveAccount(c, token.UserID) {
+		return
+	}
+
+	personalAccessTokenService.Touch(token.ID, c.ClientIP())
+
+	c.Set("personalAccessTokenID", token.ID)
+	c.Set("tokenScopes", services.TokenScopes(token))
+	c.Set("userID", token.UserID)
+	c.Set("userEmail", token.User.Email)
+	c.Set("userRole", token.User.Role.Name)
+	c.Next()
+}
+
+// authenticateServiceAccount - AuthMiddleware for client credentials tokens.
+// There is no user and no account status, the service account must still
+// exist and be enabled. Its current role is used, not the one in the token.
+func authenticateServiceAccount(c *gin.Context, claims *utils.Claims) {
+	role, err := serviceAccountService.Role(claims.ServiceAccountID)
+	if err == services.ErrServiceAccountNotFound || err == services.ErrServiceAccountDisabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Service account is disabled or no longer exists"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to check service account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check service account"})
+		c.Abort()
+		return
+	}
+
+	if claims.Scope != "" {
+		c.Set("tokenScopes", strings.Fields(claims.Scope))
+	}
+	c.Set("claims", claims)
+	c.Set("serviceAccountID", claims.ServiceAccountID)
+	c.Set("clientID", claims.ClientID)
+	c.Set("userRole", role)
+	c.Next()
+}
+
+// RequireUser - Reject service account tokens, for routes acting on the
+// signed in user. Must run after AuthMiddleware.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("userID") == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a user account"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireInteractiveLogin - Reject requests made with an impersonation token,
+// a personal access token or a service account token, for changes only the account owner may make
+// after signing in (password, two-factor, passkeys, sessions, tokens). Must
+// run after AuthMiddleware.
+func RequireInteractiveLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("impersonatorID") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed while impersonating a user"})
+			c.Abort()
+			return
+		}
+		if c.GetUint("personalAccessTokenID") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed with a personal access token"})
+			c.Abort()
+			return
+		}
+		if c.GetUint("serviceAccountID") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed for service accounts"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -49,3 +265,63 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 		c.Abort()
 	}
 }
+
+// RequirePermission - Allow only callers whose role is granted all given
+// permissions. AuthMiddleware resolves the caller's current role and its
+// permissions come from the database (both cached), not from token claims, so
+// changes apply without waiting for tokens to expire. Personal access tokens
+// also need every permission among their scopes. Must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := permissionService.HasPermission(c.GetString("userRole"), permissions...)
+		if err != nil {
+			log.Printf("Failed to resolve permissions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		if scopes, ok := c.Get("tokenScopes"); ok {
+			for _, permission := range permissions {
+				if !slices.Contains(scopes.([]string), permission) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Token scope does not include " + permission})
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail - Under the "restrict" verification policy, reject users
+// whose email is not verified yet. Must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	verificationService := services.NewVerificationService()
+
+	return func(c *gin.Context) {
+		// Service accounts have no email address
+		if services.EmailVerificationPolicy() != services.VerificationRestrict || c.GetUint("serviceAccountID") != 0 {
+			c.Next()
+			return
+		}
+
+		if !verificationService.IsVerified(c.GetUint("userID")) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "Please verify your email address to access this resource",
+				"email_verified": false,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
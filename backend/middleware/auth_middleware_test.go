@@ -0,0 +1,355 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakePermissions map[string][]string
+
+func (f fakePermissions) HasPermission(role string, permissions ...string) (bool, error) {
+	if role == "broken" {
+		return false, errors.New("database unavailable")
+	}
+	for _, permission := range permissions {
+		granted := false
+		for _, name := range f[role] {
+			granted = granted || name == permission
+		}
+		if !granted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type fakeAccount struct {
+	status string
+	role   string
+}
+
+type fakeAccounts map[uint]fakeAccount
+
+func (f fakeAccounts) Status(userID uint) (string, error) {
+	account, ok := f[userID]
+	if !ok {
+		return "", services.ErrUserNotFound
+	}
+	return account.status, nil
+}
+
+func (f fakeAccounts) Role(userID uint) (string, error) {
+	account, ok := f[userID]
+	if !ok {
+		return "", services.ErrUserNotFound
+	}
+	return account.role, nil
+}
+
+type fakePersonalAccessTokens map[string]*models.PersonalAccessToken
+
+func (f fakePersonalAccessTokens) Authenticate(raw string) (*models.PersonalAccessToken, error) {
+	token, ok := f[raw]
+	if !ok {
+		return nil, services.ErrPersonalAccessTokenInvalid
+	}
+	return token, nil
+}
+
+func (f fakePersonalAccessTokens) Touch(tokenID uint, ipAddress string) {}
+
+// fakeServiceAccounts - ID -> role, "" for a disabled account
+type fakeServiceAccounts map[uint]string
+
+func (f fakeServiceAccounts) Role(id uint) (string, error) {
+	role, ok := f[id]
+	if !ok {
+		return "", services.ErrServiceAccountNotFound
+	}
+	if role == "" {
+		return "", services.ErrServiceAccountDisabled
+	}
+	return role, nil
+}
+
+// replace - Swap a package service for the duration of the test
+func replace[T any](t *testing.T, target *T, fake T) {
+	t.Helper()
+	original := *target
+	*target = fake
+	t.Cleanup(func() { *target = original })
+}
+
+// serveAuthenticated - Run a request with header through AuthMiddleware and
+// return the status and the context values the handler saw
+func serveAuthenticated(t *testing.T, header string) (int, map[string]interface{}) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/", AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":   c.GetUint("userID"),
+			"user_role": c.GetString("userRole"),
+			"scopes":    c.GetStringSlice("tokenScopes"),
+		})
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	router.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func generateAccessToken(t *testing.T, userID uint, role string) string {
+	t.Helper()
+	token, err := utils.GenerateJWT(userID, "user@example.com", role, 0, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	replace[accountStatusChecker](t, &accountStatusService, fakeAccounts{
+		1: {status: models.AccountStatusActive, role: "viewer"},
+		2: {status: models.AccountStatusSuspended, role: "admin"},
+	})
+
+	revoked := generateAccessToken(t, 1, "viewer")
+	claims, err := utils.ValidateAccessToken(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.NewRevocationService().Remember(&models.RevokedToken{JTI: claims.ID, UserID: 1, ExpiresAt: claims.ExpiresAt.Time})
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantRole   string
+	}{
+		{name: "missing header", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer not-a-token", wantStatus: http.StatusUnauthorized},
+		{name: "revoked token", header: "Bearer " + revoked, wantStatus: http.StatusUnauthorized},
+		{name: "inactive account", header: "Bearer " + generateAccessToken(t, 2, "admin"), wantStatus: http.StatusForbidden},
+		{name: "deleted user", header: "Bearer " + generateAccessToken(t, 3, "admin"), wantStatus: http.StatusUnauthorized},
+		// The role was changed after the token was issued
+		{name: "current role", header: "Bearer " + generateAccessToken(t, 1, "admin"), wantStatus: http.StatusOK, wantRole: "viewer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serveAuthenticated(t, tt.header)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %v", status, tt.wantStatus, body)
+			}
+			if tt.wantStatus == http.StatusOK && body["user_role"] != tt.wantRole {
+				t.Errorf("got role %v, want %q", body["user_role"], tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsEndedImpersonation(t *testing.T) {
+	replace[accountStatusChecker](t, &accountStatusService, fakeAccounts{
+		1: {status: models.AccountStatusActive, role: "viewer"},
+		2: {status: models.AccountStatusSuspended, role: "admin"},
+	})
+
+	token, _, err := utils.GenerateImpersonationToken(1, "user@example.com", "viewer", nil, 2, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := serveAuthenticated(t, "Bearer "+token); status != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d: %v", status, http.StatusUnauthorized, body)
+	}
+}
+
+// serveWithContext - Run RequirePermission with the values AuthMiddleware
+// would have set
+func serveWithContext(values map[string]interface{}, handler gin.HandlerFunc) int {
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		for key, value := range values {
+			c.Set(key, value)
+		}
+	}, handler, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	replace[permissionChecker](t, &permissionService, fakePermissions{
+		"admin":  {"users:read", "users:write"},
+		"viewer": {"users:read"},
+	})
+
+	tests := []struct {
+		name        string
+		role        string
+		permissions []string
+		wantStatus  int
+	}{
+		{name: "granted", role: "viewer", permissions: []string{"users:read"}, wantStatus: http.StatusNoContent},
+		{name: "all granted", role: "admin", permissions: []string{"users:read", "users:write"}, wantStatus: http.StatusNoContent},
+		{name: "missing", role: "viewer", permissions: []string{"users:write"}, wantStatus: http.StatusForbidden},
+		{name: "one of several missing", role: "viewer", permissions: []string{"users:read", "users:write"}, wantStatus: http.StatusForbidden},
+		{name: "no role", permissions: []string{"users:read"}, wantStatus: http.StatusForbidden},
+		{name: "lookup fails", role: "broken", permissions: []string{"users:read"}, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := serveWithContext(map[string]interface{}{"userRole": tt.role}, RequirePermission(tt.permissions...))
+			if status != tt.wantStatus {
+				t.Errorf("got status %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewarePersonalAccessToken(t *testing.T) {
+	replace[accountStatusChecker](t, &accountStatusService, fakeAccounts{
+		1: {status: models.AccountStatusActive, role: "editor"},
+		2: {status: models.AccountStatusLocked, role: "editor"},
+	})
+	replace[personalAccessTokenChecker](t, &personalAccessTokenService, fakePersonalAccessTokens{
+		"pat_active": {ID: 10, UserID: 1, Scopes: "posts:read,users:read", User: models.User{ID: 1, Role: models.Role{Name: "editor"}}},
+		"pat_locked": {ID: 11, UserID: 2, Scopes: "posts:read", User: models.User{ID: 2, Role: models.Role{Name: "editor"}}},
+	})
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantScopes []interface{}
+	}{
+		{name: "valid", header: "Bearer pat_active", wantStatus: http.StatusOK, wantScopes: []interface{}{"posts:read", "users:read"}},
+		{name: "unknown", header: "Bearer pat_unknown", wantStatus: http.StatusUnauthorized},
+		{name: "owner locked", header: "Bearer pat_locked", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serveAuthenticated(t, tt.header)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %v", status, tt.wantStatus, body)
+			}
+			if tt.wantStatus == http.StatusOK && !reflect.DeepEqual(body["scopes"], tt.wantScopes) {
+				t.Errorf("got scopes %v, want %v", body["scopes"], tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestRequirePermissionScopes(t *testing.T) {
+	replace[permissionChecker](t, &permissionService, fakePermissions{
+		"editor": {"posts:read", "posts:write", "users:read"},
+	})
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		permissions []string
+		wantStatus  int
+	}{
+		{name: "in scope", scopes: []string{"posts:read"}, permissions: []string{"posts:read"}, wantStatus: http.StatusNoContent},
+		{name: "granted to the role but not in scope", scopes: []string{"posts:read"}, permissions: []string{"posts:write"}, wantStatus: http.StatusForbidden},
+		{name: "one of several not in scope", scopes: []string{"posts:read"}, permissions: []string{"posts:read", "users:read"}, wantStatus: http.StatusForbidden},
+		{name: "no scopes", scopes: []string{}, permissions: []string{"posts:read"}, wantStatus: http.StatusForbidden},
+		// A scope kept after the role lost the permission grants nothing
+		{name: "in scope but not granted", scopes: []string{"users:write"}, permissions: []string{"users:write"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]interface{}{"userRole": "editor", "tokenScopes": tt.scopes}
+			if status := serveWithContext(values, RequirePermission(tt.permissions...)); status != tt.wantStatus {
+				t.Errorf("got status %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareServiceAccount(t *testing.T) {
+	replace[serviceAccountChecker](t, &serviceAccountService, fakeServiceAccounts{1: "reporter", 2: ""})
+
+	generate := func(id uint, role, scope string) string {
+		token, _, err := utils.GenerateServiceAccountToken(id, "sa_test", role, scope, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantRole   string
+		wantScopes interface{} // nil for all role permissions
+	}{
+		// Role changed since the token was issued
+		{name: "current role", header: generate(1, "admin", ""), wantStatus: http.StatusOK, wantRole: "reporter"},
+		{name: "scoped", header: generate(1, "reporter", "reports:read reports:export"), wantStatus: http.StatusOK, wantRole: "reporter", wantScopes: []interface{}{"reports:read", "reports:export"}},
+		{name: "disabled", header: generate(2, "reporter", ""), wantStatus: http.StatusUnauthorized},
+		{name: "deleted", header: generate(3, "reporter", ""), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serveAuthenticated(t, tt.header)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %v", status, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if body["user_id"] != float64(0) || body["user_role"] != tt.wantRole {
+				t.Errorf("got user %v role %v, want no user and role %q", body["user_id"], body["user_role"], tt.wantRole)
+			}
+			if !reflect.DeepEqual(body["scopes"], tt.wantScopes) {
+				t.Errorf("got scopes %v, want %v", body["scopes"], tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     map[string]interface{}
+		wantStatus int
+	}{
+		{name: "user", values: map[string]interface{}{"userID": uint(1)}, wantStatus: http.StatusNoContent},
+		{name: "service account", values: map[string]interface{}{"serviceAccountID": uint(1)}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := serveWithContext(tt.values, RequireUser()); status != tt.wantStatus {
+				t.Errorf("got status %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc - Identity a request is counted against
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP - Count per client IP. X-Forwarded-For is only honoured from
+// TRUSTED_PROXIES (see main.go), so clients cannot rotate their key by
+// sending the header themselves.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser - Count per authenticated user or service account, falls back to IP
+// for anonymous requests.
+// Must run after AuthMiddleware.
+func KeyByUser(c *gin.Context) string {
+	if userID := c.GetUint("userID"); userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	if serviceAccountID := c.GetUint("serviceAccountID"); serviceAccountID != 0 {
+		return fmt.Sprintf("service_account:%d", serviceAccountID)
+	}
+	return KeyByIP(c)
+}
+
+// KeyByAPIKey - Count per personal access token or service account client,
+// so that scripts and jobs get their own budget instead of sharing the one of
+// the owner's interactive sessions. Other requests are counted by KeyByUser.
+// Must run after AuthMiddleware.
+func KeyByAPIKey(c *gin.Context) string {
+	if tokenID := c.GetUint("personalAccessTokenID"); tokenID != 0 {
+		return fmt.Sprintf("token:%d", tokenID)
+	}
+	if clientID := c.GetString("clientID"); clientID != "" {
+		return "client:" + clientID
+	}
+	return KeyByUser(c)
+}
+
+// RateLimitPolicy - Limit requests of one identity in a window
+type RateLimitPolicy struct {
+	Name   string // separates counters of different route groups
+	Limit  int
+	Window time.Duration
+	KeyBy  KeyFunc
+}
+
+// RateLimit - Sliding window rate limiting with RateLimit-* headers
+// (IETF draft-ietf-httpapi-ratelimit-headers)
+func RateLimit(policy RateLimitPolicy) gin.HandlerFunc {
+	if policy.KeyBy == nil {
+		policy.KeyBy = KeyByIP
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds()))
+
+	return func(c *gin.Context) {
+		key := "rl:" + policy.Name + ":" + policy.KeyBy(c)
+
+		result, err := services.DefaultRateLimiter().Allow(key, policy.Limit, policy.Window)
+		if err != nil {
+			// Fail open, an unavailable backend must not take the API down
+			log.Printf("Rate limiter error: %v", err)
+			c.Next()
+			return
+		}
+
+		reset := int(math.Ceil(result.Reset.Seconds()))
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(reset))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(reset))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, please try again later",
+				"retry_after": reset,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
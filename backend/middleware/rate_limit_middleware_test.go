@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     map[string]interface{}
+		wantUser   string
+		wantAPIKey string
+	}{
+		{name: "anonymous", wantUser: "ip:192.0.2.1", wantAPIKey: "ip:192.0.2.1"},
+		{name: "user", values: map[string]interface{}{"userID": uint(7)}, wantUser: "user:7", wantAPIKey: "user:7"},
+		{
+			name:       "personal access token",
+			values:     map[string]interface{}{"userID": uint(7), "personalAccessTokenID": uint(3)},
+			wantUser:   "user:7",
+			wantAPIKey: "token:3",
+		},
+		{
+			name:       "service account",
+			values:     map[string]interface{}{"serviceAccountID": uint(4), "clientID": "sa_abc"},
+			wantUser:   "service_account:4",
+			wantAPIKey: "client:sa_abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = "192.0.2.1:1234"
+			for key, value := range tt.values {
+				c.Set(key, value)
+			}
+
+			if got := KeyByUser(c); got != tt.wantUser {
+				t.Errorf("KeyByUser: got %q, want %q", got, tt.wantUser)
+			}
+			if got := KeyByAPIKey(c); got != tt.wantAPIKey {
+				t.Errorf("KeyByAPIKey: got %q, want %q", got, tt.wantAPIKey)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(RateLimit(RateLimitPolicy{Name: "test-" + t.Name(), Limit: 2, Window: time.Hour}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := request("192.0.2.1")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: got status %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: got RateLimit-Remaining %q, want %q", i+1, got, wantRemaining)
+		}
+		if got := w.Header().Get("RateLimit-Policy"); got != "2;w=3600" {
+			t.Errorf("got RateLimit-Policy %q", got)
+		}
+	}
+
+	w := request("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("Retry-After") != w.Header().Get("RateLimit-Reset") {
+		t.Errorf("got Retry-After %q, RateLimit-Reset %q", w.Header().Get("Retry-After"), w.Header().Get("RateLimit-Reset"))
+	}
+
+	if w := request("192.0.2.2"); w.Code != http.StatusNoContent {
+		t.Errorf("other client got status %d", w.Code)
+	}
+}
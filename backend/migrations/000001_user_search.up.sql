@@ -0,0 +1,15 @@
+-- Full-text and fuzzy search on users (services.SearchService).
+-- Run with golang-migrate: migrate -path migrations -database "$DATABASE_URL" up
+-- Without pg_trgm (e.g. no permission to create extensions) search falls back to ILIKE.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', translate(coalesce(email, ''), '@._-+', '     ')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
@@ -0,0 +1,3 @@
+-- Fails while a deleted and an active user share an email, purge one first
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
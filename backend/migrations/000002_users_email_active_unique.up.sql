@@ -0,0 +1,5 @@
+-- Email only has to be unique among users that are not soft-deleted, so a
+-- deleted user's address can be registered again (restore checks for conflicts)
+
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email) WHERE deleted_at IS NULL;
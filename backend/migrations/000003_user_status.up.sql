@@ -0,0 +1,22 @@
+-- Account status lifecycle (services.AccountStatusService)
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS status_reason text,
+    ADD COLUMN IF NOT EXISTS status_changed_at timestamptz,
+    ADD COLUMN IF NOT EXISTS status_expires_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+
+CREATE TABLE IF NOT EXISTS user_status_changes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL,
+    from_status text,
+    to_status text,
+    reason text,
+    expires_at timestamptz,
+    changed_by bigint
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_status_changes_user_id ON user_status_changes (user_id);
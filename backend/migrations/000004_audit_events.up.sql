@@ -0,0 +1,39 @@
+-- Hash-chained audit log (package audit). Rows are append-only, the trigger
+-- rejects UPDATE and DELETE so that changes need to bypass it deliberately,
+-- and `go run ./cmd/auditverify` detects rows that were altered anyway.
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    actor_id bigint,
+    actor_email text,
+    action text NOT NULL,
+    outcome text,
+    target_type text,
+    target_id text,
+    changes jsonb,
+    metadata jsonb,
+    ip_address text,
+    user_agent text,
+    request_id text,
+    prev_hash text,
+    hash text NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events (hash);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_request_id ON audit_events (request_id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,3 @@
+-- Events written while an admin impersonates a user record the admin here
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_id bigint;
+CREATE INDEX IF NOT EXISTS idx_audit_events_impersonator_id ON audit_events (impersonator_id);
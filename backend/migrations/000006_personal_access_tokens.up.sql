@@ -0,0 +1,19 @@
+-- Personal access tokens (services.PersonalAccessTokenService)
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL,
+    name text NOT NULL,
+    prefix text,
+    token_hash text NOT NULL,
+    scopes text,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip text,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_expires_at ON personal_access_tokens (expires_at);
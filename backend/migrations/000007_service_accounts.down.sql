@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_audit_events_service_account_id;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS service_account_id;
+DROP TABLE IF EXISTS service_account_secrets;
+DROP TABLE IF EXISTS service_accounts;
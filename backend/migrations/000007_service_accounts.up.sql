@@ -0,0 +1,37 @@
+-- Service accounts with client credentials (services.ServiceAccountService)
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    name text NOT NULL,
+    description text,
+    client_id text NOT NULL,
+    owner_id bigint NOT NULL,
+    role_id bigint NOT NULL,
+    disabled_at timestamptz,
+    last_used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_accounts_name ON service_accounts (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_accounts_client_id ON service_accounts (client_id);
+CREATE INDEX IF NOT EXISTS idx_service_accounts_owner_id ON service_accounts (owner_id);
+CREATE INDEX IF NOT EXISTS idx_service_accounts_role_id ON service_accounts (role_id);
+
+CREATE TABLE IF NOT EXISTS service_account_secrets (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    service_account_id bigint NOT NULL,
+    prefix text,
+    secret_hash text NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_account_secrets_secret_hash ON service_account_secrets (secret_hash);
+CREATE INDEX IF NOT EXISTS idx_service_account_secrets_service_account_id ON service_account_secrets (service_account_id);
+
+-- Requests made with a service account token have no user
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS service_account_id bigint;
+CREATE INDEX IF NOT EXISTS idx_audit_events_service_account_id ON audit_events (service_account_id);
@@ -0,0 +1,17 @@
+-- Pending passkey ceremonies (services.WebAuthnService), deleted when answered
+-- or by the hourly cleanup once expired
+
+CREATE TABLE IF NOT EXISTS web_authn_ceremonies (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    token_hash text NOT NULL,
+    purpose text NOT NULL,
+    user_id bigint,
+    challenge bytea NOT NULL,
+    allowed_credentials text,
+    user_verification text,
+    expires_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_ceremonies_token_hash ON web_authn_ceremonies (token_hash);
+CREATE INDEX IF NOT EXISTS idx_web_authn_ceremonies_expires_at ON web_authn_ceremonies (expires_at);
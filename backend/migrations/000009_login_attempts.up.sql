@@ -0,0 +1,12 @@
+-- Failed login counters shared by all instances (LOGIN_LIMITER_STORE=postgres,
+-- services.PostgresLoginAttemptStore). Keys are "account:<email>" or "ip:<address>".
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key text PRIMARY KEY,
+    updated_at timestamptz,
+    failures bigint NOT NULL DEFAULT 0,
+    last_failure_at timestamptz,
+    locked_until timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_locked_until ON login_attempts (locked_until);
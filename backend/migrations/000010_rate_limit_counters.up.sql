@@ -0,0 +1,10 @@
+-- Rate limit counters shared by all instances (RATE_LIMIT_STORE=postgres,
+-- services.PostgresRateLimitStore). Expired rows are purged by the store.
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key text PRIMARY KEY,
+    count bigint NOT NULL DEFAULT 0,
+    expires_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters (expires_at);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS web_authn_credentials;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS revoked_tokens;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS mfa_enabled,
+    DROP COLUMN IF EXISTS email_verified_at;
+DROP INDEX IF EXISTS idx_roles_parent_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS parent_id;
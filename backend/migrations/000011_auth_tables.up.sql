@@ -0,0 +1,122 @@
+-- Tables and columns that were added with AutoMigrate before versioned
+-- migrations were introduced (token revocation, refresh token families,
+-- sessions, TOTP, passkeys, email verification, password resets, role
+-- hierarchy and invitations). Databases created with AutoMigrate already have
+-- all of it, every statement is IF NOT EXISTS.
+
+-- Role hierarchy, permissions of the parent are inherited
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS parent_id bigint;
+
+CREATE INDEX IF NOT EXISTS idx_roles_parent_id ON roles (parent_id);
+
+-- Email verification and TOTP two-factor authentication
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at timestamptz,
+    ADD COLUMN IF NOT EXISTS mfa_enabled boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS totp_secret text,
+    ADD COLUMN IF NOT EXISTS totp_last_step bigint;
+
+-- Token denylist (services.RevocationService)
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    jti text,
+    session_id bigint,
+    user_id bigint,
+    expires_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_session_id ON revoked_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+-- Rotating refresh tokens, one family per login (services.RefreshTokenService)
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL,
+    family_id text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    replaced_by bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Signed-in devices (services.SessionService)
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id bigint NOT NULL,
+    family_id text NOT NULL,
+    user_agent text,
+    ip_address text,
+    last_seen_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions (family_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL,
+    code_hash text NOT NULL,
+    used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mfa_recovery_codes_code_hash ON mfa_recovery_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+-- Passkeys (services.WebAuthnService)
+CREATE TABLE IF NOT EXISTS web_authn_credentials (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id bigint NOT NULL,
+    name text,
+    credential_id text NOT NULL,
+    public_key bytea NOT NULL,
+    sign_count bigint,
+    aaguid text,
+    transports text,
+    last_used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_credentials_credential_id ON web_authn_credentials (credential_id);
+CREATE INDEX IF NOT EXISTS idx_web_authn_credentials_user_id ON web_authn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_resets_token_hash ON password_resets (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+CREATE INDEX IF NOT EXISTS idx_password_resets_expires_at ON password_resets (expires_at);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    email text NOT NULL,
+    role_id bigint NOT NULL,
+    invited_by bigint,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    accepted_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_token_hash ON invitations (token_hash);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
@@ -0,0 +1 @@
+ALTER TABLE service_accounts DROP CONSTRAINT IF EXISTS fk_service_accounts_owner;
@@ -0,0 +1,12 @@
+-- Service accounts belong to an existing user. Deleting a user disables their
+-- accounts, purging deletes them (services.UserService). Accounts whose owner
+-- was purged before this migration are removed together with their secrets.
+
+DELETE FROM service_account_secrets
+WHERE service_account_id IN (
+    SELECT id FROM service_accounts WHERE owner_id NOT IN (SELECT id FROM users)
+);
+DELETE FROM service_accounts WHERE owner_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE service_accounts
+    ADD CONSTRAINT fk_service_accounts_owner FOREIGN KEY (owner_id) REFERENCES users (id);
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,10 +13,47 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 	Name      string         `json:"name" gorm:"not null"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
+	Email     string         `json:"email" gorm:"uniqueIndex:idx_users_email,where:deleted_at IS NULL;not null"`
 	Password  string         `json:"-" gorm:"not null"`
 	RoleID    uint           `json:"role_id"`
 	Role      Role           `json:"role" gorm:"foreignKey:RoleID"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Account status, only active accounts can sign in. StatusExpiresAt ends a
+	// suspension automatically.
+	Status          string     `json:"status" gorm:"size:20;not null;default:active;index"`
+	StatusReason    string     `json:"status_reason"`
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+	StatusExpiresAt *time.Time `json:"status_expires_at"`
+
+	// Two-factor authentication (TOTP). Secret is set during enrollment and
+	// only enforced once MFAEnabled is true.
+	MFAEnabled   bool   `json:"mfa_enabled" gorm:"default:false"`
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `json:"-"`
+}
+
+// Account statuses
+const (
+	AccountStatusPending     = "pending" // registered, waiting for approval
+	AccountStatusActive      = "active"
+	AccountStatusSuspended   = "suspended" // temporarily, may expire
+	AccountStatusLocked      = "locked"    // for security reasons, until unlocked
+	AccountStatusDeactivated = "deactivated"
+)
+
+// UserStatusChange - One account status transition. ChangedBy is nil for
+// automatic changes such as an expired suspension.
+type UserStatusChange struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	FromStatus string     `json:"from_status"`
+	ToStatus   string     `json:"to_status"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	ChangedBy  *uint      `json:"changed_by"`
 }
 
 type Role struct {
@@ -24,6 +62,7 @@ type Role struct {
 	UpdatedAt   time.Time        `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt   `json:"-" gorm:"index"`
 	Name        string           `json:"name" gorm:"uniqueIndex;not null"`
+	ParentID    *uint            `json:"parent_id" gorm:"index"` // permissions of the parent are inherited
 	Users       []User           `json:"-" gorm:"foreignKey:RoleID"`
 	Permissions []RolePermission `json:"permissions" gorm:"foreignKey:RoleID"`
 }
@@ -48,6 +87,226 @@ type RolePermission struct {
 	Permission   Permission `json:"permission" gorm:"foreignKey:PermissionID"`
 }
 
+// Permission names used by routes, in "resource:action" form
+const (
+	PermUsersRead            = "users:read"
+	PermUsersWrite           = "users:write"
+	PermUsersDelete          = "users:delete"
+	PermUsersSecurity        = "users:security" // revoke tokens, reset MFA, account status
+	PermUsersImpersonate     = "users:impersonate"
+	PermAuditRead            = "audit:read"
+	PermServiceAccountsRead  = "service_accounts:read"
+	PermServiceAccountsWrite = "service_accounts:write"
+	PermRolesRead            = "roles:read"
+	PermRolesWrite           = "roles:write" // roles granting this count as admin roles
+	PermLockoutsRead         = "lockouts:read"
+	PermLockoutsWrite        = "lockouts:write"
+	PermReportsRead          = "reports:read"
+	PermAdminDashboard       = "dashboard:admin"
+	PermManagerDashboard     = "dashboard:manager"
+)
+
+// BuiltinPermissions - Permissions referenced by routes, they cannot be deleted
+var BuiltinPermissions = []string{
+	PermUsersRead, PermUsersWrite, PermUsersDelete, PermUsersSecurity, PermUsersImpersonate,
+	PermRolesRead, PermRolesWrite, PermAuditRead,
+	PermServiceAccountsRead, PermServiceAccountsWrite,
+	PermLockoutsRead, PermLockoutsWrite,
+	PermReportsRead, PermAdminDashboard, PermManagerDashboard,
+}
+
+// RevokedToken - Denylist entry. Jika JTI diisi hanya token itu yang revoked,
+// jika SessionID diisi semua token dari session itu, selain itu semua token
+// milik UserID yang diterbitkan sebelum CreatedAt dianggap revoked.
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	JTI       string    `json:"jti" gorm:"index"`
+	SessionID uint      `json:"session_id" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// Session - One signed-in device, linked to a refresh token family
+type Session struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID   string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RefreshToken - Opaque single-use refresh token. Tokens from one login share
+// a FamilyID so that reuse of a rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID   string     `json:"family_id" gorm:"index;not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uint      `json:"replaced_by"`
+}
+
+// PersonalAccessToken - Long-lived token a user creates for scripts and CI,
+// stored hashed. Scopes limit it to a subset of the user's permissions.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix"` // first characters, to recognize the token
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"-"` // comma separated permission names
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ServiceAccount - Non-human identity for backend jobs, owned by an admin.
+// It authenticates with ClientID and a secret (OAuth2 client credentials) and
+// has the permissions of its role.
+type ServiceAccount struct {
+	ID          uint                   `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	Name        string                 `json:"name" gorm:"uniqueIndex;not null"`
+	Description string                 `json:"description"`
+	ClientID    string                 `json:"client_id" gorm:"uniqueIndex;not null"`
+	OwnerID     uint                   `json:"owner_id" gorm:"index;not null"`
+	Owner       User                   `json:"owner" gorm:"foreignKey:OwnerID"`
+	RoleID      uint                   `json:"role_id" gorm:"index;not null"`
+	Role        Role                   `json:"role" gorm:"foreignKey:RoleID"`
+	DisabledAt  *time.Time             `json:"disabled_at"`
+	LastUsedAt  *time.Time             `json:"last_used_at"`
+	Secrets     []ServiceAccountSecret `json:"secrets,omitempty" gorm:"foreignKey:ServiceAccountID"`
+}
+
+// ServiceAccountSecret - Client secret of a service account, stored hashed.
+// A rotation sets ExpiresAt on the previous secrets, they keep working until
+// then so that jobs can switch over.
+type ServiceAccountSecret struct {
+	ID               uint       `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ServiceAccountID uint       `json:"service_account_id" gorm:"index;not null"`
+	Prefix           string     `json:"prefix"` // first characters, to recognize the secret
+	SecretHash       string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt        *time.Time `json:"expires_at"` // nil until rotated out
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// MFARecoveryCode - One-time recovery code, stored hashed
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// WebAuthnCredential - Passkey registered by a user
+type WebAuthnCredential struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `json:"user_id" gorm:"index;not null"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id" gorm:"uniqueIndex;not null"` // base64url
+	PublicKey    []byte     `json:"-" gorm:"not null"`                         // COSE_Key
+	SignCount    uint32     `json:"-"`
+	AAGUID       string     `json:"aaguid"`
+	Transports   string     `json:"transports"` // comma separated
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnCeremony - Pending passkey ceremony, deleted when answered so each
+// challenge is used once. The ceremony ID sent to the client is stored hashed.
+type WebAuthnCeremony struct {
+	ID                 uint      `json:"id" gorm:"primarykey"`
+	CreatedAt          time.Time `json:"created_at"`
+	TokenHash          string    `json:"-" gorm:"uniqueIndex;not null"`
+	Purpose            string    `json:"purpose" gorm:"not null"`
+	UserID             uint      `json:"user_id"` // 0 for a discoverable login
+	Challenge          []byte    `json:"-" gorm:"not null"`
+	AllowedCredentials string    `json:"-"` // comma separated base64url credential IDs
+	UserVerification   string    `json:"user_verification"`
+	ExpiresAt          time.Time `json:"expires_at" gorm:"index"`
+}
+
+// LoginAttempt - Failed login counter for an account or client IP
+// (key "account:<email>" or "ip:<address>")
+type LoginAttempt struct {
+	Key           string     `json:"key" gorm:"primarykey"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// RateLimitCounter - Request counter of one rate limit window
+type RateLimitCounter struct {
+	Key       string    `json:"key" gorm:"primarykey"`
+	Count     int64     `json:"count"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// PasswordReset - Single-use password reset token, stored hashed
+type PasswordReset struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// Invitation - Admin invitation to register with a given role, bound to one
+// email address. The token is sent by email and stored hashed.
+type Invitation struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Email      string     `json:"email" gorm:"index;not null"`
+	RoleID     uint       `json:"role_id" gorm:"not null"`
+	Role       Role       `json:"role" gorm:"foreignKey:RoleID"`
+	InvitedBy  uint       `json:"invited_by"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// AuditEvent - Append-only record of a security or admin action. Each row
+// carries the hash of the previous row, so editing or deleting a row breaks
+// the chain (see audit.Verify and cmd/auditverify).
+type AuditEvent struct {
+	ID               uint            `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time       `json:"created_at" gorm:"index"`
+	ActorID          *uint           `json:"actor_id" gorm:"index"` // nil for anonymous requests
+	ActorEmail       string          `json:"actor_email"`
+	ImpersonatorID   *uint           `json:"impersonator_id" gorm:"index"`    // who actually acted as ActorID
+	ServiceAccountID *uint           `json:"service_account_id" gorm:"index"` // actor of machine requests
+	Action           string          `json:"action" gorm:"index;not null"`
+	Outcome          string          `json:"outcome"` // success or failure
+	TargetType       string          `json:"target_type" gorm:"index:idx_audit_events_target"`
+	TargetID         string          `json:"target_id" gorm:"index:idx_audit_events_target"`
+	Changes          json.RawMessage `json:"changes" gorm:"type:jsonb"` // field -> {from, to}
+	Metadata         json.RawMessage `json:"metadata" gorm:"type:jsonb"`
+	IPAddress        string          `json:"ip_address"`
+	UserAgent        string          `json:"user_agent"`
+	RequestID        string          `json:"request_id" gorm:"index"`
+	PrevHash         string          `json:"prev_hash"`
+	Hash             string          `json:"hash" gorm:"uniqueIndex;not null"`
+}
+
 // Request/Response structs
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required"`
@@ -1,58 +1,155 @@
 package routes
 
 import (
+	"time"
+
 	"backend/controllers"
 	"backend/middleware"
+	"backend/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Rate limit policies per route group
+var (
+	authRateLimit = middleware.RateLimitPolicy{Name: "auth", Limit: 30, Window: time.Minute, KeyBy: middleware.KeyByIP}
+	// Endpoints that create accounts or send emails are limited much harder
+	registerRateLimit      = middleware.RateLimitPolicy{Name: "register", Limit: 5, Window: time.Hour, KeyBy: middleware.KeyByIP}
+	passwordResetRateLimit = middleware.RateLimitPolicy{Name: "password-reset", Limit: 5, Window: time.Hour, KeyBy: middleware.KeyByIP}
+	verificationRateLimit  = middleware.RateLimitPolicy{Name: "verification", Limit: 5, Window: time.Hour, KeyBy: middleware.KeyByIP}
+	apiRateLimit           = middleware.RateLimitPolicy{Name: "api", Limit: 300, Window: time.Minute, KeyBy: middleware.KeyByAPIKey}
+)
+
 func SetupAuthRoutes(api *gin.RouterGroup) {
 	auth := api.Group("/auth")
+	auth.Use(middleware.RateLimit(authRateLimit))
 	{
-		auth.POST("/register", controllers.Register)
+		auth.POST("/register", middleware.RateLimit(registerRateLimit), controllers.Register)
 		auth.POST("/login", controllers.Login)
+		auth.POST("/mfa/verify", controllers.VerifyMFA)
 		auth.POST("/logout", controllers.Logout)
 		auth.POST("/refresh", controllers.RefreshToken)
-		auth.POST("/forgot-password", controllers.ForgotPassword)
+		auth.POST("/forgot-password", middleware.RateLimit(passwordResetRateLimit), controllers.ForgotPassword)
 		auth.POST("/reset-password", controllers.ResetPassword)
+		auth.POST("/verify-email", controllers.VerifyEmail)
+		auth.POST("/resend-verification", middleware.RateLimit(verificationRateLimit), controllers.ResendVerification)
+	}
+
+	passkey := auth.Group("/webauthn")
+	{
+		passkey.POST("/register/begin", middleware.AuthMiddleware(), middleware.RequireInteractiveLogin(), controllers.BeginPasskeyRegistration)
+		passkey.POST("/register/finish", middleware.AuthMiddleware(), middleware.RequireInteractiveLogin(), controllers.FinishPasskeyRegistration)
+		passkey.POST("/login/begin", controllers.BeginPasskeyLogin)
+		passkey.POST("/login/finish", controllers.FinishPasskeyLogin)
+		passkey.POST("/mfa/begin", controllers.BeginPasskeyMFA)
+		passkey.POST("/mfa/finish", controllers.FinishPasskeyMFA)
 	}
 }
 
 func SetupUserRoutes(api *gin.RouterGroup) {
 	user := api.Group("/user")
-	user.Use(middleware.AuthMiddleware())
+	user.Use(middleware.AuthMiddleware(), middleware.RequireUser(), middleware.RateLimit(apiRateLimit))
 	{
 		user.GET("/me", controllers.GetCurrentUser)
-		user.GET("/profile", controllers.GetUserProfile)
-		user.PUT("/profile", controllers.UpdateUserProfile)
 		user.GET("/dashboard", controllers.GetUserDashboard)
 	}
+
+	// Account management needs a normal login, personal access tokens,
+	// impersonation and service account tokens are refused
+	account := user.Group("", middleware.RequireInteractiveLogin())
+	{
+		account.GET("/profile", controllers.GetUserProfile)
+		account.PUT("/profile", controllers.UpdateUserProfile)
+		account.PATCH("/profile", controllers.UpdateUserProfile)
+		account.GET("/sessions", controllers.GetSessions)
+		account.DELETE("/sessions", controllers.RevokeOtherSessions)
+		account.DELETE("/sessions/:id", controllers.RevokeSession)
+		account.GET("/mfa", controllers.GetMFAStatus)
+		account.POST("/mfa/totp/setup", controllers.SetupTOTP)
+		account.POST("/mfa/totp/confirm", controllers.ConfirmTOTP)
+		account.POST("/mfa/recovery-codes", controllers.RegenerateRecoveryCodes)
+		account.DELETE("/mfa", controllers.DisableMFA)
+		account.GET("/passkeys", controllers.GetPasskeys)
+		account.DELETE("/passkeys/:id", controllers.DeletePasskey)
+		account.GET("/tokens", controllers.GetPersonalAccessTokens)
+		account.POST("/tokens", controllers.CreatePersonalAccessToken)
+		account.DELETE("/tokens/:id", controllers.RevokePersonalAccessToken)
+	}
 }
 
 func SetupAdminRoutes(api *gin.RouterGroup) {
 	admin := api.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.RoleMiddleware("admin"))
+	admin.Use(middleware.AuthMiddleware(), middleware.RateLimit(apiRateLimit), middleware.RequireVerifiedEmail())
 	{
-		admin.GET("/users", controllers.GetUsers)
-		admin.POST("/users", controllers.CreateUser)
-		admin.PUT("/users/:id", controllers.UpdateUser)
-		admin.DELETE("/users/:id", controllers.DeleteUser)
-		admin.GET("/dashboard", controllers.GetAdminDashboard)
+		admin.GET("/users", middleware.RequirePermission(models.PermUsersRead), controllers.GetUsers)
+		admin.GET("/users/search", middleware.RequirePermission(models.PermUsersRead), controllers.SearchUsers)
+		admin.POST("/users", middleware.RequirePermission(models.PermUsersWrite), controllers.CreateUser)
+		admin.PUT("/users/:id", middleware.RequirePermission(models.PermUsersWrite), controllers.UpdateUser)
+		admin.PATCH("/users/:id", middleware.RequirePermission(models.PermUsersWrite), controllers.UpdateUser)
+		admin.DELETE("/users/:id", middleware.RequirePermission(models.PermUsersDelete), controllers.DeleteUser)
+		admin.GET("/users/deleted", middleware.RequirePermission(models.PermUsersRead), controllers.GetDeletedUsers)
+		admin.POST("/users/:id/restore", middleware.RequirePermission(models.PermUsersWrite), controllers.RestoreUser)
+		admin.DELETE("/users/:id/purge", middleware.RequirePermission(models.PermUsersDelete), controllers.PurgeUser)
+		admin.POST("/users/:id/revoke-tokens", middleware.RequirePermission(models.PermUsersSecurity), controllers.RevokeUserTokens)
+		admin.DELETE("/users/:id/mfa", middleware.RequirePermission(models.PermUsersSecurity), controllers.ResetUserMFA)
+		admin.POST("/users/:id/impersonate", middleware.RequireInteractiveLogin(), middleware.RequirePermission(models.PermUsersImpersonate), controllers.ImpersonateUser)
+		admin.POST("/users/:id/status", middleware.RequirePermission(models.PermUsersSecurity), controllers.SetUserStatus)
+		admin.GET("/users/:id/status-history", middleware.RequirePermission(models.PermUsersRead), controllers.GetUserStatusHistory)
+		admin.GET("/invitations", middleware.RequirePermission(models.PermUsersWrite), controllers.GetInvitations)
+		admin.POST("/invitations", middleware.RequirePermission(models.PermUsersWrite), controllers.InviteUser)
+		admin.DELETE("/invitations/:id", middleware.RequirePermission(models.PermUsersWrite), controllers.RevokeInvitation)
+		admin.GET("/roles", middleware.RequirePermission(models.PermRolesRead), controllers.GetRoles)
+		admin.POST("/roles", middleware.RequirePermission(models.PermRolesWrite), controllers.CreateRole)
+		admin.GET("/roles/:id", middleware.RequirePermission(models.PermRolesRead), controllers.GetRole)
+		admin.PUT("/roles/:id", middleware.RequirePermission(models.PermRolesWrite), controllers.UpdateRole)
+		admin.DELETE("/roles/:id", middleware.RequirePermission(models.PermRolesWrite), controllers.DeleteRole)
+		admin.PUT("/roles/:id/parent", middleware.RequirePermission(models.PermRolesWrite), controllers.SetRoleParent)
+		admin.GET("/roles/:id/effective-permissions", middleware.RequirePermission(models.PermRolesRead), controllers.GetEffectivePermissions)
+		admin.POST("/roles/:id/permissions/:permissionId", middleware.RequirePermission(models.PermRolesWrite), controllers.AttachRolePermission)
+		admin.DELETE("/roles/:id/permissions/:permissionId", middleware.RequirePermission(models.PermRolesWrite), controllers.DetachRolePermission)
+		admin.GET("/permissions", middleware.RequirePermission(models.PermRolesRead), controllers.GetPermissions)
+		admin.POST("/permissions", middleware.RequirePermission(models.PermRolesWrite), controllers.CreatePermission)
+		admin.PUT("/permissions/:id", middleware.RequirePermission(models.PermRolesWrite), controllers.UpdatePermission)
+		admin.DELETE("/permissions/:id", middleware.RequirePermission(models.PermRolesWrite), controllers.DeletePermission)
+		admin.GET("/audit", middleware.RequirePermission(models.PermAuditRead), controllers.GetAuditEvents)
+		admin.GET("/service-accounts", middleware.RequirePermission(models.PermServiceAccountsRead), controllers.GetServiceAccounts)
+		admin.POST("/service-accounts", middleware.RequireUser(), middleware.RequirePermission(models.PermServiceAccountsWrite), controllers.CreateServiceAccount)
+		admin.GET("/service-accounts/:id", middleware.RequirePermission(models.PermServiceAccountsRead), controllers.GetServiceAccount)
+		admin.PATCH("/service-accounts/:id", middleware.RequireUser(), middleware.RequirePermission(models.PermServiceAccountsWrite), controllers.UpdateServiceAccount)
+		admin.DELETE("/service-accounts/:id", middleware.RequireUser(), middleware.RequirePermission(models.PermServiceAccountsWrite), controllers.DeleteServiceAccount)
+		admin.POST("/service-accounts/:id/secrets", middleware.RequireUser(), middleware.RequirePermission(models.PermServiceAccountsWrite), controllers.RotateServiceAccountSecret)
+		admin.DELETE("/service-accounts/:id/secrets/:secretId", middleware.RequireUser(), middleware.RequirePermission(models.PermServiceAccountsWrite), controllers.RevokeServiceAccountSecret)
+		admin.GET("/lockouts", middleware.RequirePermission(models.PermLockoutsRead), controllers.GetLockouts)
+		admin.DELETE("/lockouts/:key", middleware.RequirePermission(models.PermLockoutsWrite), controllers.ClearLockout)
+		admin.GET("/dashboard", middleware.RequirePermission(models.PermAdminDashboard), controllers.GetAdminDashboard)
+	}
+}
+
+func SetupOAuthRoutes(api *gin.RouterGroup) {
+	oauth := api.Group("/oauth")
+	oauth.Use(middleware.RateLimit(authRateLimit))
+	{
+		oauth.POST("/token", controllers.IssueOAuthToken)
 	}
 }
 
 func SetupManagerRoutes(api *gin.RouterGroup) {
 	manager := api.Group("/manager")
-	manager.Use(middleware.AuthMiddleware(), middleware.RoleMiddleware("admin", "manager"))
+	manager.Use(middleware.AuthMiddleware(), middleware.RateLimit(apiRateLimit), middleware.RequireVerifiedEmail())
 	{
-		manager.GET("/reports", controllers.GetReports)
-		manager.GET("/dashboard", controllers.GetManagerDashboard)
+		manager.GET("/reports", middleware.RequirePermission(models.PermReportsRead), controllers.GetReports)
+		manager.GET("/dashboard", middleware.RequirePermission(models.PermManagerDashboard), controllers.GetManagerDashboard)
 	}
 }
 
 // SetupAllRoutes - Setup semua routes sekaligus
 func SetupAllRoutes(r *gin.Engine) {
+	// Request ID for logs and the audit trail
+	r.Use(middleware.RequestID())
+
+	// Public signing keys (JWKS) for token verification by other services
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	api := r.Group("/api")
 	{
 		// Health check endpoint
@@ -68,5 +165,6 @@ func SetupAllRoutes(r *gin.Engine) {
 		SetupUserRoutes(api)
 		SetupAdminRoutes(api)
 		SetupManagerRoutes(api)
+		SetupOAuthRoutes(api)
 	}
 }
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountStatusCacheTTL - How long AuthMiddleware trusts a cached status and
+// role. Changes made through this service invalidate the entry at once and
+// revoke the user's tokens, the TTL only bounds changes made elsewhere.
+const AccountStatusCacheTTL = 30 * time.Second
+
+var (
+	ErrUnknownAccountStatus    = errors.New("unknown account status")
+	ErrInvalidStatusTransition = errors.New("status transition not allowed")
+	ErrStatusReasonRequired    = errors.New("a reason is required for this status")
+	ErrInvalidStatusExpiry     = errors.New("expires_at is only allowed for suspensions and must be in the future")
+)
+
+// accountStatusTransitions - Allowed transitions, from -> to. A suspension can
+// be changed (e.g. extended) while it is running.
+var accountStatusTransitions = map[string][]string{
+	models.AccountStatusPending:     {models.AccountStatusActive, models.AccountStatusDeactivated},
+	models.AccountStatusActive:      {models.AccountStatusSuspended, models.AccountStatusLocked, models.AccountStatusDeactivated},
+	models.AccountStatusSuspended:   {models.AccountStatusActive, models.AccountStatusSuspended, models.AccountStatusLocked, models.AccountStatusDeactivated},
+	models.AccountStatusLocked:      {models.AccountStatusActive, models.AccountStatusDeactivated},
+	models.AccountStatusDeactivated: {models.AccountStatusActive},
+}
+
+// statusRequiresReason - Statuses that block sign-in must say why
+var statusRequiresReason = map[string]bool{
+	models.AccountStatusSuspended:   true,
+	models.AccountStatusLocked:      true,
+	models.AccountStatusDeactivated: true,
+}
+
+// IsAccountStatus - Whether status is one of the account statuses
+func IsAccountStatus(status string) bool {
+	_, ok := accountStatusTransitions[status]
+	return ok
+}
+
+// RegistrationRequiresApproval - Public registrations start as pending until
+// an admin activates them (REGISTRATION_REQUIRE_APPROVAL=true)
+func RegistrationRequiresApproval() bool {
+	return os.Getenv("REGISTRATION_REQUIRE_APPROVAL") == "true"
+}
+
+type cachedAccountStatus struct {
+	status    string
+	role      string
+	expiresAt *time.Time
+	loadedAt  time.Time
+}
+
+// accountStatusCache - User ID -> status and role
+var accountStatusCache = struct {
+	mu    sync.RWMutex
+	users map[uint]cachedAccountStatus
+}{users: make(map[uint]cachedAccountStatus)}
+
+// AccountStatusService - Account status state machine. Every transition is
+// recorded in user_status_changes.
+type AccountStatusService struct{}
+
+func NewAccountStatusService() *AccountStatusService {
+	return &AccountStatusService{}
+}
+
+// Resolve - Effective status of a loaded user. An expired suspension is ended
+// on the spot and user is updated in place.
+func (s *AccountStatusService) Resolve(user *models.User) (string, error) {
+	if !suspensionExpired(user.Status, user.StatusExpiresAt, time.Now()) {
+		return user.Status, nil
+	}
+
+	updated, err := s.Transition(user.ID, models.AccountStatusActive, "Suspension expired", nil, nil)
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		// Changed concurrently, use the current state
+		updated, err = NewUserService().GetUserByID(user.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	user.Status = updated.Status
+	user.StatusReason = updated.StatusReason
+	user.StatusChangedAt = updated.StatusChangedAt
+	user.StatusExpiresAt = updated.StatusExpiresAt
+	return user.Status, nil
+}
+
+// Status - Effective status of a user by ID, served from cache
+func (s *AccountStatusService) Status(userID uint) (string, error) {
+	cached, err := s.load(userID)
+	if err != nil {
+		return "", err
+	}
+	return cached.status, nil
+}
+
+// Role - Current role name of a user by ID, served from cache. Authorization
+// uses this rather than the role signed into access tokens, so that role
+// changes apply without waiting for tokens to expire.
+func (s *AccountStatusService) Role(userID uint) (string, error) {
+	cached, err := s.load(userID)
+	if err != nil {
+		return "", err
+	}
+	return cached.role, nil
+}
+
+func (s *AccountStatusService) load(userID uint) (cachedAccountStatus, error) {
+	accountStatusCache.mu.RLock()
+	cached, ok := accountStatusCache.users[userID]
+	accountStatusCache.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < AccountStatusCacheTTL && !suspensionExpired(cached.status, cached.expiresAt, time.Now()) {
+		return cached, nil
+	}
+
+	var user models.User
+	err := config.DB.Select("id", "role_id", "status", "status_reason", "status_changed_at", "status_expires_at").
+		Preload("Role", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).
+		First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cached, ErrUserNotFound
+		}
+		return cached, err
+	}
+	status, err := s.Resolve(&user)
+	if err != nil {
+		return cached, err
+	}
+
+	cached = cachedAccountStatus{status: status, role: user.Role.Name, expiresAt: user.StatusExpiresAt, loadedAt: time.Now()}
+	accountStatusCache.mu.Lock()
+	accountStatusCache.users[userID] = cached
+	accountStatusCache.mu.Unlock()
+	return cached, nil
+}
+
+// Transition - Move a user to another status. changedBy is nil for automatic
+// changes. Leaving active signs the user out everywhere.
+func (s *AccountStatusService) Transition(userID uint, to, reason string, expiresAt *time.Time, changedBy *uint) (*models.User, error) {
+	if !IsAccountStatus(to) {
+		return nil, ErrUnknownAccountStatus
+	}
+	if statusRequiresReason[to] && reason == "" {
+		return nil, ErrStatusReasonRequired
+	}
+	if expiresAt != nil && (to != models.AccountStatusSuspended || !expiresAt.After(time.Now())) {
+		return nil, ErrInvalidStatusExpiry
+	}
+
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		from := user.Status
+		if !transitionAllowed(from, to) {
+			return ErrInvalidStatusTransition
+		}
+
+		now := time.Now()
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"status":            to,
+			"status_reason":     reason,
+			"status_changed_at": now,
+			"status_expires_at": expiresAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserStatusChange{
+			UserID:     user.ID,
+			FromStatus: from,
+			ToStatus:   to,
+			Reason:     reason,
+			ExpiresAt:  expiresAt,
+			ChangedBy:  changedBy,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Invalidate(userID)
+	if to != models.AccountStatusActive {
+		if err := NewRevocationService().RevokeAllForUser(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewUserService().GetUserByID(userID)
+}
+
+// History - Status changes of a user, newest first
+func (s *AccountStatusService) History(userID uint) ([]models.UserStatusChange, error) {
+	var changes []models.UserStatusChange
+	err := config.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&changes).Error
+	return changes, err
+}
+
+// ExpireSuspensions - Reactivate users whose suspension has ended
+func (s *AccountStatusService) ExpireSuspensions() (int, error) {
+	var ids []uint
+	err := config.DB.Model(&models.User{}).
+		Where("status = ? AND status_expires_at <= ?", models.AccountStatusSuspended, time.Now()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		_, err := s.Transition(id, models.AccountStatusActive, "Suspension expired", nil, nil)
+		if err != nil && !errors.Is(err, ErrInvalidStatusTransition) {
+			return expired, err
+		}
+		if err == nil {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// StartExpirySweep - End expired suspensions periodically so that they also
+// show up correctly in the user list
+func (s *AccountStatusService) StartExpirySweep(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.ExpireSuspensions(); err != nil {
+				log.Printf("Failed to expire suspensions: %v", err)
+			}
+		}
+	}()
+}
+
+// Invalidate - Drop the cached status and role of a user, e.g. after a role change
+func (s *AccountStatusService) Invalidate(userID uint) {
+	accountStatusCache.mu.Lock()
+	delete(accountStatusCache.users, userID)
+	accountStatusCache.mu.Unlock()
+}
+
+// InvalidateAll - Drop all cached users, e.g. after roles were renamed or deleted
+func (s *AccountStatusService) InvalidateAll() {
+	accountStatusCache.mu.Lock()
+	accountStatusCache.users = make(map[uint]cachedAccountStatus)
+	accountStatusCache.mu.Unlock()
+}
+
+func transitionAllowed(from, to string) bool {
+	for _, allowed := range accountStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func suspensionExpired(status string, expiresAt *time.Time, now time.Time) bool {
+	return status == models.AccountStatusSuspended && expiresAt != nil && !expiresAt.After(now)
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+)
+
+// LoginAttemptStore - Backend keeping failed login counters
+type LoginAttemptStore interface {
+	// RecordFailure - Atomically count a failure. Counters whose last failure
+	// is older than resetBefore start again from one.
+	RecordFailure(key string, now, resetBefore time.Time) (models.LoginAttempt, error)
+	// Lock - Set the lockout expiry of a key
+	Lock(key string, until time.Time) error
+	Get(key string) (models.LoginAttempt, bool, error)
+	Delete(key string) error
+	// ListLocked - Keys locked at the given time
+	ListLocked(now time.Time) ([]models.LoginAttempt, error)
+}
+
+// LockoutPolicy - When and how long keys get locked
+type LockoutPolicy struct {
+	MaxAccountFailures int           // failures per account before lockout
+	MaxIPFailures      int           // failures per client IP before lockout
+	BaseLockout        time.Duration // first lockout, doubled for every further failure
+	MaxLockout         time.Duration
+	ResetAfter         time.Duration // failures older than this are forgotten
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxAccountFailures: 5,
+	MaxIPFailures:      20,
+	BaseLockout:        time.Minute,
+	MaxLockout:         time.Hour,
+	ResetAfter:         24 * time.Hour,
+}
+
+// LoginLimiter - Brute-force protection for login per account and per client IP
+type LoginLimiter struct {
+	store  LoginAttemptStore
+	policy LockoutPolicy
+}
+
+func NewLoginLimiter(store LoginAttemptStore, policy LockoutPolicy) *LoginLimiter {
+	return &LoginLimiter{store: store, policy: policy}
+}
+
+var defaultLoginLimiter = struct {
+	once    sync.Once
+	limiter *LoginLimiter
+}{}
+
+// DefaultLoginLimiter - Limiter configured from environment:
+//
+//	LOGIN_LIMITER_STORE     memory (default) or postgres (migrations/000009_login_attempts)
+//	LOGIN_MAX_FAILURES      failures per account before lockout
+//	LOGIN_MAX_IP_FAILURES   failures per IP before lockout
+func DefaultLoginLimiter() *LoginLimiter {
+	defaultLoginLimiter.once.Do(func() {
+		policy := DefaultLockoutPolicy
+		if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+			policy.MaxAccountFailures = n
+		}
+		if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES")); err == nil && n > 0 {
+			policy.MaxIPFailures = n
+		}
+
+		var store LoginAttemptStore
+		switch os.Getenv("LOGIN_LIMITER_STORE") {
+		case "postgres":
+			store = NewPostgresLoginAttemptStore()
+		case "", "memory":
+			store = newPrunedMemoryLoginAttemptStore(policy)
+		default:
+			log.Printf("Unknown LOGIN_LIMITER_STORE %q, using memory", os.Getenv("LOGIN_LIMITER_STORE"))
+			store = newPrunedMemoryLoginAttemptStore(policy)
+		}
+
+		defaultLoginLimiter.limiter = NewLoginLimiter(store, policy)
+	})
+	return defaultLoginLimiter.limiter
+}
+
+func newPrunedMemoryLoginAttemptStore(policy LockoutPolicy) *MemoryLoginAttemptStore {
+	store := NewMemoryLoginAttemptStore()
+	store.StartPrune(time.Minute, policy.ResetAfter)
+	return store
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check - Return how long the caller has to wait, zero when login may proceed
+func (l *LoginLimiter) Check(email, ip string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+
+	for _, key := range []string{AccountKey(email), IPKey(ip)} {
+		attempt, found, err := l.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if found && attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			if remaining := attempt.LockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordFailure - Count a failed attempt and lock keys over their threshold.
+// Returns the lockout duration if this failure caused one.
+func (l *LoginLimiter) RecordFailure(email, ip string) (time.Duration, error) {
+	accountWait, err := l.fail(AccountKey(email), l.policy.MaxAccountFailures)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := l.fail(IPKey(ip), l.policy.MaxIPFailures)
+	if err != nil {
+		return 0, err
+	}
+
+	if ipWait > accountWait {
+		return ipWait, nil
+	}
+	return accountWait, nil
+}
+
+func (l *LoginLimiter) fail(key string, maxFailures int) (time.Duration, error) {
+	now := time.Now()
+	attempt, err := l.store.RecordFailure(key, now, now.Add(-l.policy.ResetAfter))
+	if err != nil {
+		return 0, err
+	}
+	if attempt.Failures < maxFailures {
+		return 0, nil
+	}
+
+	// Exponential backoff: base, 2x base, 4x base, ... capped at MaxLockout
+	lockout := l.policy.BaseLockout
+	for i := maxFailures; i < attempt.Failures && lockout < l.policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.policy.MaxLockout {
+		lockout = l.policy.MaxLockout
+	}
+
+	log.Printf("SECURITY: %s locked for %s after %d failed logins", key, lockout, attempt.Failures)
+	return lockout, l.store.Lock(key, now.Add(lockout))
+}
+
+// RecordSuccess - Clear the account counter after a successful login
+func (l *LoginLimiter) RecordSuccess(email string) error {
+	return l.store.Delete(AccountKey(email))
+}
+
+// ListLocked - Currently locked accounts and IPs
+func (l *LoginLimiter) ListLocked() ([]models.LoginAttempt, error) {
+	return l.store.ListLocked(time.Now())
+}
+
+// Clear - Remove lockout and failure counter of a key
+func (l *LoginLimiter) Clear(key string) error {
+	return l.store.Delete(key)
+}
+
+// MemoryLoginAttemptStore - Per-process store, counters are lost on restart
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]models.LoginAttempt)}
+}
+
+// StartPrune - Drop counters without failures since resetAfter and without an
+// active lockout periodically, so that the map does not grow forever
+func (s *MemoryLoginAttemptStore) StartPrune(interval, resetAfter time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			s.prune(now, now.Add(-resetAfter))
+		}
+	}()
+}
+
+func (s *MemoryLoginAttemptStore) prune(now, resetBefore time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, attempt := range s.attempts {
+		if attempt.LastFailureAt.Before(resetBefore) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(key string, now, resetBefore time.Time) (models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	// Old failures no longer count, the entry may not have been pruned yet
+	if attempt.LastFailureAt.Before(resetBefore) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	attempt.UpdatedAt = now
+	s.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = &until
+	attempt.UpdatedAt = time.Now()
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Get(key string) (models.LoginAttempt, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	return attempt, ok, nil
+}
+
+func (s *MemoryLoginAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) ListLocked(now time.Time) ([]models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locked := []models.LoginAttempt{}
+	for _, attempt := range s.attempts {
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			locked = append(locked, attempt)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Key < locked[j].Key })
+	return locked, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"gorm.io/gorm"
+)
+
+// PostgresLoginAttemptStore - Store shared by all instances via the login_attempts table
+type PostgresLoginAttemptStore struct{}
+
+func NewPostgresLoginAttemptStore() *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{}
+}
+
+func (s *PostgresLoginAttemptStore) RecordFailure(key string, now, resetBefore time.Time) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := config.DB.Raw(`
+		INSERT INTO login_attempts (key, updated_at, failures, last_failure_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING *`, key, now, now, resetBefore).Scan(&attempt).Error
+	return attempt, err
+}
+
+func (s *PostgresLoginAttemptStore) Lock(key string, until time.Time) error {
+	return config.DB.Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *PostgresLoginAttemptStore) Get(key string) (models.LoginAttempt, bool, error) {
+	var attempt models.LoginAttempt
+	err := config.DB.Where("key = ?", key).First(&attempt).Error
+	if err == gorm.ErrRecordNotFound {
+		return attempt, false, nil
+	}
+	return attempt, err == nil, err
+}
+
+func (s *PostgresLoginAttemptStore) Delete(key string) error {
+	return config.DB.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func (s *PostgresLoginAttemptStore) ListLocked(now time.Time) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := config.DB.Where("locked_until > ?", now).Order("key").Find(&attempts).Error
+	return attempts, err
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testLockoutPolicy = LockoutPolicy{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	BaseLockout:        time.Minute,
+	MaxLockout:         5 * time.Minute,
+	ResetAfter:         time.Hour,
+}
+
+func TestLoginLimiterLocksAccount(t *testing.T) {
+	limiter := NewLoginLimiter(NewMemoryLoginAttemptStore(), testLockoutPolicy)
+
+	// Lockouts of the 1st to 6th failure: none until the threshold, then
+	// doubling up to MaxLockout
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, wantLockout := range want {
+		// A new IP every time, only the account counter may lock
+		lockout, err := limiter.RecordFailure("Jane@Example.com", fmt.Sprintf("10.0.0.%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lockout != wantLockout {
+			t.Errorf("failure %d: got lockout %s, want %s", i+1, lockout, wantLockout)
+		}
+	}
+
+	wait, err := limiter.Check(" jane@example.com", "10.0.0.99")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 4*time.Minute || wait > 5*time.Minute {
+		t.Errorf("got wait %s, want up to %s", wait, 5*time.Minute)
+	}
+
+	if wait, _ := limiter.Check("john@example.com", "10.0.0.99"); wait != 0 {
+		t.Errorf("other account has to wait %s", wait)
+	}
+}
+
+func TestLoginLimiterLocksIP(t *testing.T) {
+	limiter := NewLoginLimiter(NewMemoryLoginAttemptStore(), testLockoutPolicy)
+
+	var lockout time.Duration
+	for i := 0; i < testLockoutPolicy.MaxIPFailures; i++ {
+		// A new account every time, only the IP counter may lock
+		var err error
+		lockout, err = limiter.RecordFailure(fmt.Sprintf("user%d@example.com", i), "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lockout != time.Minute {
+		t.Errorf("got lockout %s, want %s", lockout, time.Minute)
+	}
+
+	if wait, _ := limiter.Check("new@example.com", "10.0.0.1"); wait == 0 {
+		t.Error("locked IP may log in")
+	}
+	if wait, _ := limiter.Check("new@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("other IP has to wait %s", wait)
+	}
+}
+
+func TestLoginLimiterRecordSuccess(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	limiter := NewLoginLimiter(store, testLockoutPolicy)
+
+	for i := 0; i < testLockoutPolicy.MaxAccountFailures-1; i++ {
+		if _, err := limiter.RecordFailure("jane@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := limiter.RecordSuccess("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, _ := store.Get(AccountKey("jane@example.com")); found {
+		t.Error("account counter kept after a successful login")
+	}
+	// The IP counter is not reset by logging into one account
+	if attempt, found, _ := store.Get(IPKey("10.0.0.1")); !found || attempt.Failures != 2 {
+		t.Errorf("got IP counter %+v, want 2 failures", attempt)
+	}
+	if lockout, _ := limiter.RecordFailure("jane@example.com", "10.0.0.1"); lockout != 0 {
+		t.Errorf("got lockout %s after a successful login", lockout)
+	}
+}
+
+func TestLoginLimiterClear(t *testing.T) {
+	limiter := NewLoginLimiter(NewMemoryLoginAttemptStore(), testLockoutPolicy)
+	for i := 0; i < testLockoutPolicy.MaxAccountFailures; i++ {
+		if _, err := limiter.RecordFailure("jane@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	locked, err := limiter.ListLocked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locked) != 1 || locked[0].Key != AccountKey("jane@example.com") {
+		t.Fatalf("got locked %+v, want the account", locked)
+	}
+
+	if err := limiter.Clear(AccountKey("jane@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := limiter.Check("jane@example.com", "10.0.0.1"); wait != 0 {
+		t.Errorf("cleared account has to wait %s", wait)
+	}
+	if locked, _ := limiter.ListLocked(); len(locked) != 0 {
+		t.Errorf("got locked %+v after clear", locked)
+	}
+}
+
+func TestMemoryLoginAttemptStoreReset(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.RecordFailure("account:jane", start, start.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last failure is older than resetBefore, counting starts over
+	later := start.Add(2 * time.Hour)
+	attempt, err := store.RecordFailure("account:jane", later, later.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 1 {
+		t.Errorf("got %d failures, want 1", attempt.Failures)
+	}
+}
+
+func TestMemoryLoginAttemptStorePrune(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	store.RecordFailure("stale", old, old)
+	store.RecordFailure("recent", now, now)
+	store.RecordFailure("locked", old, old)
+	store.Lock("locked", now.Add(time.Minute))
+	store.RecordFailure("lock expired", old, old)
+	store.Lock("lock expired", now.Add(-time.Minute))
+
+	store.prune(now, now.Add(-time.Hour))
+
+	for key, want := range map[string]bool{"stale": false, "recent": true, "locked": true, "lock expired": false} {
+		if _, found, _ := store.Get(key); found != want {
+			t.Errorf("%s: got kept %v, want %v", key, found, want)
+		}
+	}
+}
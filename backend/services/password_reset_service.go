@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetLifetime - Reset tokens expire after 1 hour
+const PasswordResetLifetime = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordResetService struct{}
+
+func NewPasswordResetService() *PasswordResetService {
+	return &PasswordResetService{}
+}
+
+// Issue - Create a reset token for the user. Older outstanding tokens are invalidated.
+func (s *PasswordResetService) Issue(userID uint) (string, error) {
+	raw := utils.GenerateOpaqueToken()
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.invalidate(tx, userID); err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    userID,
+			TokenHash: utils.HashToken(raw),
+			ExpiresAt: time.Now().Add(PasswordResetLifetime),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Consume - Atomically use a reset token, set the new password hash and
+// revoke every session of the user. Nothing changes if any step fails.
+func (s *PasswordResetService) Consume(raw, passwordHash string) (uint, error) {
+	var userID uint
+	var revoked *models.RevokedToken
+	revocationService := NewRevocationService()
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional update, so a token can only be used once even under concurrency
+		var reset models.PasswordReset
+		result := tx.Raw(`
+			UPDATE password_resets SET used_at = ?
+			WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+			RETURNING *`, time.Now(), utils.HashToken(raw), time.Now()).Scan(&reset)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		userID = reset.UserID
+
+		update := tx.Model(&models.User{}).Where("id = ?", userID).Update("password", passwordHash)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		if err := s.invalidate(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		revoked, err = revocationService.RevokeAllForUserTx(tx, userID, 0)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	revocationService.Remember(revoked)
+	return userID, nil
+}
+
+// InvalidateForUser - Drop outstanding reset tokens, e.g. after the password changed
+func (s *PasswordResetService) InvalidateForUser(userID uint) error {
+	return s.invalidate(config.DB, userID)
+}
+
+func (s *PasswordResetService) invalidate(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ? AND used_at IS NULL", userID).Delete(&models.PasswordReset{}).Error
+}
+
+// PurgeExpired - Delete used and expired reset rows
+func (s *PasswordResetService) PurgeExpired() (int64, error) {
+	result := config.DB.Where("expires_at <= ? OR used_at IS NOT NULL", time.Now()).Delete(&models.PasswordReset{})
+	return result.RowsAffected, result.Error
+}
+
+// StartCleanup - Periodically purge expired reset rows
+func (s *PasswordResetService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge password resets: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+// PermissionCacheTTL - How long resolved role permissions are kept. Changes made
+// through this service invalidate the cache at once, the TTL only bounds how
+// long other instances keep serving stale permissions.
+const PermissionCacheTTL = time.Minute
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionNotFound = errors.New("permission not found")
+)
+
+type cachedPermissions struct {
+	names    map[string]bool
+	loadedAt time.Time
+}
+
+// permissionCache - Role name -> permission names
+var permissionCache = struct {
+	mu    sync.RWMutex
+	roles map[string]cachedPermissions
+}{roles: make(map[string]cachedPermissions)}
+
+type PermissionService struct{}
+
+func NewPermissionService() *PermissionService {
+	return &PermissionService{}
+}
+
+// EmbedPermissionsInTokens - Whether access tokens carry the role's permissions
+// (JWT_EMBED_PERMISSIONS=true), so services verifying tokens via JWKS can
+// authorize without a database lookup
+func EmbedPermissionsInTokens() bool {
+	embed, _ := strconv.ParseBool(os.Getenv("JWT_EMBED_PERMISSIONS"))
+	return embed
+}
+
+// RolePermissions - Permission names granted to a role, including those
+// inherited from its parent roles, served from cache
+func (s *PermissionService) RolePermissions(role string) (map[string]bool, error) {
+	permissionCache.mu.RLock()
+	cached, ok := permissionCache.roles[role]
+	permissionCache.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < PermissionCacheTTL {
+		return cached.names, nil
+	}
+
+	graph, err := loadRoleGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	if roleID, found := graph.byName(role); found {
+		for name := range graph.effective(roleID) {
+			set[name] = true
+		}
+	}
+
+	permissionCache.mu.Lock()
+	permissionCache.roles[role] = cachedPermissions{names: set, loadedAt: time.Now()}
+	permissionCache.mu.Unlock()
+	return set, nil
+}
+
+// EffectivePermission - Permission of a role and the role that grants it
+type EffectivePermission struct {
+	Permission string `json:"permission"`
+	GrantedBy  string `json:"granted_by"`
+	Inherited  bool   `json:"inherited"`
+}
+
+// EffectivePermissions - All permissions of a role, explaining for each which
+// role in the hierarchy grants it
+func (s *PermissionService) EffectivePermissions(roleID uint) ([]EffectivePermission, error) {
+	graph, err := loadRoleGraph()
+	if err != nil {
+		return nil, err
+	}
+	role, ok := graph.roles[roleID]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+
+	granted := graph.effective(roleID)
+	result := make([]EffectivePermission, 0, len(granted))
+	for name, grantedBy := range granted {
+		result = append(result, EffectivePermission{
+			Permission: name,
+			GrantedBy:  grantedBy,
+			Inherited:  grantedBy != role.Name,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Permission < result[j].Permission })
+	return result, nil
+}
+
+// HasPermission - Whether the role is granted all of the given permissions
+func (s *PermissionService) HasPermission(role string, permissions ...string) (bool, error) {
+	granted, err := s.RolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range permissions {
+		if !granted[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PermissionList - Sorted permission names of a role, e.g. for responses
+func (s *PermissionService) PermissionList(role string) ([]string, error) {
+	granted, err := s.RolePermissions(role)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(granted))
+	for name := range granted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// TokenPermissions - Permissions to embed in an access token, nil when disabled
+func (s *PermissionService) TokenPermissions(role string) []string {
+	if !EmbedPermissionsInTokens() {
+		return nil
+	}
+	names, err := s.PermissionList(role)
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// CanAssign - Whether every permission of the role roleID, inherited ones
+// included, is also granted to callerRole, so handing out roleID does not
+// give anyone more than the caller has
+func (s *PermissionService) CanAssign(callerRole string, roleID uint) (bool, error) {
+	graph, err := loadRoleGraph()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := graph.roles[roleID]; !ok {
+		return false, ErrRoleNotFound
+	}
+
+	granted, err := s.RolePermissions(callerRole)
+	if err != nil {
+		return false, err
+	}
+	for name := range graph.effective(roleID) {
+		if !granted[name] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Grant - Give a permission to a role
+func (s *PermissionService) Grant(roleID, permissionID uint) error {
+	if err := config.DB.First(&models.Role{}, roleID).Error; err != nil {
+		return ErrRoleNotFound
+	}
+	if err := config.DB.First(&models.Permission{}, permissionID).Error; err != nil {
+		return ErrPermissionNotFound
+	}
+
+	var count int64
+	config.DB.Model(&models.RolePermission{}).
+		Where("role_id = ? AND permission_id = ?", roleID, permissionID).
+		Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	if err := config.DB.Create(&models.RolePermission{RoleID: roleID, PermissionID: permissionID}).Error; err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+// Revoke - Take a permission away from a role
+func (s *PermissionService) Revoke(roleID, permissionID uint) error {
+	err := config.DB.Where("role_id = ? AND permission_id = ?", roleID, permissionID).
+		Delete(&models.RolePermission{}).Error
+	if err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+// Invalidate - Drop all cached role permissions. Call after any change to
+// roles, permissions or their assignments.
+func (s *PermissionService) Invalidate() {
+	permissionCache.mu.Lock()
+	permissionCache.roles = make(map[string]cachedPermissions)
+	permissionCache.mu.Unlock()
+}
+
+// roleGraph - Role hierarchy with directly granted permissions
+type roleGraph struct {
+	roles  map[uint]models.Role
+	direct map[uint][]string // role ID -> permission names
+}
+
+func loadRoleGraph() (*roleGraph, error) {
+	var roles []models.Role
+	if err := config.DB.Select("id", "name", "parent_id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	var grants []struct {
+		RoleID uint
+		Name   string
+	}
+	err := config.DB.Table("role_permissions").
+		Select("role_permissions.role_id, permissions.name").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("permissions.deleted_at IS NULL").
+		Scan(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &roleGraph{
+		roles:  make(map[uint]models.Role, len(roles)),
+		direct: make(map[uint][]string),
+	}
+	for _, role := range roles {
+		graph.roles[role.ID] = role
+	}
+	for _, grant := range grants {
+		graph.direct[grant.RoleID] = append(graph.direct[grant.RoleID], grant.Name)
+	}
+	return graph, nil
+}
+
+func (g *roleGraph) byName(name string) (uint, bool) {
+	for id, role := range g.roles {
+		if role.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// ancestors - The role followed by its parent chain, stops at unknown roles
+// and at cycles in stored data
+func (g *roleGraph) ancestors(roleID uint) []uint {
+	var chain []uint
+	visited := make(map[uint]bool)
+	for id := roleID; ; {
+		role, ok := g.roles[id]
+		if !ok || visited[id] {
+			return chain
+		}
+		visited[id] = true
+		chain = append(chain, id)
+		if role.ParentID == nil {
+			return chain
+		}
+		id = *role.ParentID
+	}
+}
+
+// effective - Permission name -> name of the nearest role granting it
+func (g *roleGraph) effective(roleID uint) map[string]string {
+	granted := make(map[string]string)
+	for _, id := range g.ancestors(roleID) {
+		for _, name := range g.direct[id] {
+			if _, ok := granted[name]; !ok {
+				granted[name] = g.roles[id].Name
+			}
+		}
+	}
+	return granted
+}
+
+// createsCycle - Whether making parentID the parent of roleID closes a loop
+func (g *roleGraph) createsCycle(roleID, parentID uint) bool {
+	for _, id := range g.ancestors(parentID) {
+		if id == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+// anyRoleHas - Whether at least one role holds the permission, directly or inherited
+func (g *roleGraph) anyRoleHas(permission string) bool {
+	for id := range g.roles {
+		if _, ok := g.effective(id)[permission]; ok {
+			return true
+		}
+	}
+	return false
+}
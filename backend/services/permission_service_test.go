@@ -0,0 +1,295 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+// cachePermissions - Seed the permission cache so lookups need no database
+func cachePermissions(t *testing.T, roles map[string][]string) {
+	t.Helper()
+	service := NewPermissionService()
+	service.Invalidate()
+	t.Cleanup(service.Invalidate)
+
+	permissionCache.mu.Lock()
+	defer permissionCache.mu.Unlock()
+	for role, names := range roles {
+		set := make(map[string]bool, len(names))
+		for _, name := range names {
+			set[name] = true
+		}
+		permissionCache.roles[role] = cachedPermissions{names: set, loadedAt: time.Now()}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	cachePermissions(t, map[string][]string{
+		"admin":  {"users:read", "users:write", "roles:write"},
+		"viewer": {"users:read"},
+		"empty":  {},
+	})
+
+	tests := []struct {
+		name        string
+		role        string
+		permissions []string
+		want        bool
+	}{
+		{name: "single granted", role: "viewer", permissions: []string{"users:read"}, want: true},
+		{name: "single missing", role: "viewer", permissions: []string{"users:write"}},
+		{name: "all granted", role: "admin", permissions: []string{"users:read", "users:write"}, want: true},
+		{name: "one of several missing", role: "admin", permissions: []string{"users:read", "audit:read"}},
+		{name: "role without permissions", role: "empty", permissions: []string{"users:read"}},
+		{name: "nothing required", role: "empty", want: true},
+	}
+
+	service := NewPermissionService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.HasPermission(tt.role, tt.permissions...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionList(t *testing.T) {
+	cachePermissions(t, map[string][]string{
+		"admin": {"users:write", "audit:read", "users:read"},
+		"empty": {},
+	})
+
+	tests := []struct {
+		role string
+		want []string
+	}{
+		{role: "admin", want: []string{"audit:read", "users:read", "users:write"}},
+		{role: "empty", want: []string{}},
+	}
+
+	service := NewPermissionService()
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			got, err := service.PermissionList(tt.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenPermissions(t *testing.T) {
+	cachePermissions(t, map[string][]string{"admin": {"users:read", "audit:read"}})
+
+	tests := []struct {
+		name  string
+		embed string
+		want  []string
+	}{
+		{name: "disabled by default", embed: "", want: nil},
+		{name: "disabled", embed: "false", want: nil},
+		{name: "enabled", embed: "true", want: []string{"audit:read", "users:read"}},
+	}
+
+	service := NewPermissionService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_EMBED_PERMISSIONS", tt.embed)
+			if got := service.TokenPermissions("admin"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testRoleGraph - admin <- manager <- editor <- viewer, plus an unrelated
+// guest role and a broken loop a <-> b as it could exist in stored data
+func testRoleGraph() *roleGraph {
+	parent := func(id uint) *uint { return &id }
+	roles := []models.Role{
+		{ID: 1, Name: "admin"},
+		{ID: 2, Name: "manager", ParentID: parent(1)},
+		{ID: 3, Name: "editor", ParentID: parent(2)},
+		{ID: 4, Name: "viewer", ParentID: parent(3)},
+		{ID: 5, Name: "guest"},
+		{ID: 6, Name: "a", ParentID: parent(7)},
+		{ID: 7, Name: "b", ParentID: parent(6)},
+		{ID: 8, Name: "orphan", ParentID: parent(99)},
+	}
+
+	graph := &roleGraph{
+		roles: make(map[uint]models.Role, len(roles)),
+		direct: map[uint][]string{
+			1: {"roles:write", "users:delete"},
+			2: {"users:write"},
+			3: {"users:read", "reports:read"},
+			4: {"users:read"},
+			6: {"a:read"},
+			7: {"b:read"},
+		},
+	}
+	for _, role := range roles {
+		graph.roles[role.ID] = role
+	}
+	return graph
+}
+
+func TestRoleGraphAncestors(t *testing.T) {
+	tests := []struct {
+		name   string
+		roleID uint
+		want   []uint
+	}{
+		{name: "root role", roleID: 1, want: []uint{1}},
+		{name: "deep chain", roleID: 4, want: []uint{4, 3, 2, 1}},
+		{name: "stops at cycle", roleID: 6, want: []uint{6, 7}},
+		{name: "stops at unknown parent", roleID: 8, want: []uint{8}},
+		{name: "unknown role", roleID: 99, want: nil},
+	}
+
+	graph := testRoleGraph()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graph.ancestors(tt.roleID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleGraphEffective(t *testing.T) {
+	tests := []struct {
+		name   string
+		roleID uint
+		want   map[string]string // permission -> granted by
+	}{
+		{
+			name:   "root role has only its own",
+			roleID: 1,
+			want:   map[string]string{"roles:write": "admin", "users:delete": "admin"},
+		},
+		{
+			// users:read is granted by viewer itself and by editor, the nearest wins
+			name:   "inherits along the chain",
+			roleID: 4,
+			want: map[string]string{
+				"users:read":   "viewer",
+				"reports:read": "editor",
+				"users:write":  "manager",
+				"roles:write":  "admin",
+				"users:delete": "admin",
+			},
+		},
+		{
+			name:   "parents do not inherit from children",
+			roleID: 2,
+			want:   map[string]string{"users:write": "manager", "roles:write": "admin", "users:delete": "admin"},
+		},
+		{name: "role without permissions", roleID: 5, want: map[string]string{}},
+		{name: "cycle terminates", roleID: 7, want: map[string]string{"b:read": "b", "a:read": "a"}},
+	}
+
+	graph := testRoleGraph()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graph.effective(tt.roleID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleGraphCreatesCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		roleID   uint
+		parentID uint
+		want     bool
+	}{
+		{name: "own parent", roleID: 1, parentID: 1, want: true},
+		{name: "direct child as parent", roleID: 1, parentID: 2, want: true},
+		{name: "descendant as parent", roleID: 2, parentID: 4, want: true},
+		{name: "ancestor as parent", roleID: 4, parentID: 1},
+		{name: "unrelated role as parent", roleID: 5, parentID: 4},
+		{name: "move below sibling branch", roleID: 3, parentID: 5},
+	}
+
+	graph := testRoleGraph()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graph.createsCycle(tt.roleID, tt.parentID); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleGraphByName(t *testing.T) {
+	graph := testRoleGraph()
+	if id, ok := graph.byName("editor"); !ok || id != 3 {
+		t.Errorf("byName(editor) = %d, %v", id, ok)
+	}
+	if _, ok := graph.byName("missing"); ok {
+		t.Error("byName(missing) found a role")
+	}
+}
+
+func TestRemovesLastAdmin(t *testing.T) {
+	parent := func(id uint) *uint { return &id }
+	tests := []struct {
+		name   string
+		change func(g *roleGraph)
+		want   bool
+	}{
+		{
+			name:   "unrelated change",
+			change: func(g *roleGraph) { delete(g.roles, 5) },
+		},
+		{
+			name:   "delete only admin role",
+			change: func(g *roleGraph) { delete(g.roles, 1) },
+			want:   true,
+		},
+		{
+			name:   "drop roles:write from admin",
+			change: func(g *roleGraph) { g.direct[1] = []string{"users:delete"} },
+			want:   true,
+		},
+		{
+			// manager keeps roles:write through its own grant
+			name: "admin role deleted, manager grants it directly",
+			change: func(g *roleGraph) {
+				g.direct[2] = append(g.direct[2], "roles:write")
+				delete(g.roles, 1)
+			},
+		},
+		{
+			name: "detach from admin parent keeps admin itself",
+			change: func(g *roleGraph) {
+				manager := g.roles[2]
+				manager.ParentID = parent(5)
+				g.roles[2] = manager
+			},
+		},
+	}
+
+	service := NewRoleService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.removesLastAdmin(testRoleGraph(), tt.change); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
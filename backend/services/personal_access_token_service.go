@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// Personal access token lifetimes
+const (
+	DefaultPersonalAccessTokenLifetime = 30 * 24 * time.Hour
+	MaxPersonalAccessTokenLifetime     = 365 * 24 * time.Hour
+)
+
+// MaxPersonalAccessTokensPerUser - Active tokens a user may hold at once
+const MaxPersonalAccessTokensPerUser = 50
+
+// tokenTouchInterval - LastUsedAt is written at most once per interval
+const tokenTouchInterval = time.Minute
+
+// personalAccessTokenPrefixLength - Characters kept in clear to recognize a token
+const personalAccessTokenPrefixLength = len(utils.PersonalAccessTokenPrefix) + 6
+
+var (
+	ErrPersonalAccessTokenInvalid  = errors.New("invalid personal access token")
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	ErrTokenNameRequired           = errors.New("token name is required")
+	ErrInvalidTokenExpiry          = errors.New("token must expire in the future and within 365 days")
+	ErrScopeNotGranted             = errors.New("scope is not granted to your role")
+	ErrTooManyTokens               = fmt.Errorf("a user can have at most %d active tokens", MaxPersonalAccessTokensPerUser)
+)
+
+var tokenTouches = newTouchThrottle(tokenTouchInterval)
+
+type PersonalAccessTokenService struct{}
+
+func NewPersonalAccessTokenService() *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{}
+}
+
+// Create - Issue a token for the user. Scopes must be permissions of the
+// user's role, expiresAt nil means DefaultPersonalAccessTokenLifetime. The
+// raw token is returned only here.
+func (s *PersonalAccessTokenService) Create(user *models.User, name string, scopes []string, expiresAt *time.Time) (string, *models.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrTokenNameRequired
+	}
+
+	now := time.Now()
+	expiry := now.Add(DefaultPersonalAccessTokenLifetime)
+	if expiresAt != nil {
+		expiry = *expiresAt
+	}
+	if !expiry.After(now) || expiry.After(now.Add(MaxPersonalAccessTokenLifetime)) {
+		return "", nil, ErrInvalidTokenExpiry
+	}
+
+	scopes, err := s.normalizeScopes(user.Role.Name, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var active int64
+	if err := config.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, now).
+		Count(&active).Error; err != nil {
+		return "", nil, err
+	}
+	if active >= MaxPersonalAccessTokensPerUser {
+		return "", nil, ErrTooManyTokens
+	}
+
+	raw := utils.GeneratePersonalAccessToken()
+	record := models.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    raw[:personalAccessTokenPrefixLength],
+		TokenHash: utils.HashToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiry,
+	}
+	if err := config.DB.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, &record, nil
+}
+
+// normalizeScopes - Sorted, de-duplicated scopes, all granted to the role
+func (s *PersonalAccessTokenService) normalizeScopes(role string, scopes []string) ([]string, error) {
+	granted, err := NewPermissionService().RolePermissions(role)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !granted[scope] {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Authenticate - Token record (with user and role) for a raw token that is
+// neither revoked nor expired
+func (s *PersonalAccessTokenService) Authenticate(raw string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(raw, utils.PersonalAccessTokenPrefix) {
+		return nil, ErrPersonalAccessTokenInvalid
+	}
+
+	var token models.PersonalAccessToken
+	err := config.DB.Preload("User.Role").
+		Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", utils.HashToken(raw), time.Now()).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPersonalAccessTokenInvalid
+		}
+		return nil, err
+	}
+	if token.User.ID == 0 {
+		// Owner was deleted
+		return nil, ErrPersonalAccessTokenInvalid
+	}
+	return &token, nil
+}
+
+// Touch - Record the last use, throttled to avoid a write on every request
+func (s *PersonalAccessTokenService) Touch(tokenID uint, ipAddress string) {
+	now := time.Now()
+	if !tokenTouches.allow(tokenID, now) {
+		return
+	}
+
+	err := config.DB.Model(&models.PersonalAccessToken{}).Where("id = ?", tokenID).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ipAddress}).Error
+	if err != nil {
+		log.Printf("Failed to update personal access token %d last used: %v", tokenID, err)
+	}
+}
+
+// List - Tokens of a user that are not revoked, newest first. Expired tokens
+// are included so that the owner sees why a script stopped working.
+func (s *PersonalAccessTokenService) List(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := config.DB.
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at desc").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke - Revoke one token of a user
+func (s *PersonalAccessTokenService) Revoke(userID, tokenID uint) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := config.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).First(&token).Error; err != nil {
+		return nil, ErrPersonalAccessTokenNotFound
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&token).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	token.RevokedAt = &now
+	return &token, nil
+}
+
+// RevokeAllForUser - Revoke every token of a user
+func (s *PersonalAccessTokenService) RevokeAllForUser(db *gorm.DB, userID uint) error {
+	return db.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TokenScopes - Scopes of a token as a list
+func TokenScopes(token *models.PersonalAccessToken) []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
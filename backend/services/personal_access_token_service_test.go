@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	cachePermissions(t, map[string][]string{"editor": {"posts:read", "posts:write", "users:read"}})
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr error
+	}{
+		{name: "none", scopes: nil, want: []string{}},
+		{name: "sorted and de-duplicated", scopes: []string{"users:read", " posts:read", "users:read", ""}, want: []string{"posts:read", "users:read"}},
+		{name: "not granted to the role", scopes: []string{"posts:read", "users:write"}, wantErr: ErrScopeNotGranted},
+	}
+
+	service := NewPersonalAccessTokenService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.normalizeScopes("editor", tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	tests := []struct {
+		scopes string
+		want   []string
+	}{
+		{scopes: "", want: []string{}},
+		{scopes: "users:read", want: []string{"users:read"}},
+		{scopes: "posts:read,users:read", want: []string{"posts:read", "users:read"}},
+	}
+
+	for _, tt := range tests {
+		got := TokenScopes(&models.PersonalAccessToken{Scopes: tt.scopes})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TokenScopes(%q) = %v, want %v", tt.scopes, got, tt.want)
+		}
+	}
+}
+
+// Validation happens before any database access
+func TestCreatePersonalAccessTokenValidation(t *testing.T) {
+	cachePermissions(t, map[string][]string{"viewer": {"users:read"}})
+	user := &models.User{ID: 1, Role: models.Role{Name: "viewer"}}
+	past := time.Now().Add(-time.Hour)
+	tooLate := time.Now().Add(MaxPersonalAccessTokenLifetime + time.Hour)
+
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		expiresAt *time.Time
+		want      error
+	}{
+		{name: "blank name", tokenName: "  ", want: ErrTokenNameRequired},
+		{name: "expired", tokenName: "ci", expiresAt: &past, want: ErrInvalidTokenExpiry},
+		{name: "beyond the maximum lifetime", tokenName: "ci", expiresAt: &tooLate, want: ErrInvalidTokenExpiry},
+		{name: "scope above the role", tokenName: "ci", scopes: []string{"users:write"}, want: ErrScopeNotGranted},
+	}
+
+	service := NewPersonalAccessTokenService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Create(user, tt.tokenName, tt.scopes, tt.expiresAt)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
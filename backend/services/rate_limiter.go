@@ -0,0 +1,181 @@
+package services
+
+import (
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+// RateLimitStore - Backend holding request counters per window
+type RateLimitStore interface {
+	// Increment - Atomically add one to key and return the new count.
+	// The counter may be discarded after expiresAt.
+	Increment(key string, expiresAt time.Time) (int64, error)
+	Get(key string) (int64, error)
+}
+
+// RateLimitResult - Outcome of one rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration // until the current window ends
+}
+
+// RateLimiter - Sliding window counter: the previous window's count is
+// weighted by how much of it still overlaps the sliding window
+type RateLimiter struct {
+	store RateLimitStore
+}
+
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+var defaultRateLimiter = struct {
+	once    sync.Once
+	limiter *RateLimiter
+}{}
+
+// DefaultRateLimiter - Limiter with backend from RATE_LIMIT_STORE (memory or
+// postgres, see migrations/000010_rate_limit_counters)
+func DefaultRateLimiter() *RateLimiter {
+	defaultRateLimiter.once.Do(func() {
+		var store RateLimitStore
+		switch os.Getenv("RATE_LIMIT_STORE") {
+		case "postgres":
+			store = NewPostgresRateLimitStore()
+		case "", "memory":
+			store = NewMemoryRateLimitStore()
+		default:
+			log.Printf("Unknown RATE_LIMIT_STORE %q, using memory", os.Getenv("RATE_LIMIT_STORE"))
+			store = NewMemoryRateLimitStore()
+		}
+		defaultRateLimiter.limiter = NewRateLimiter(store)
+	})
+	return defaultRateLimiter.limiter
+}
+
+// Allow - Count a request for key and decide if it fits in limit per window
+func (l *RateLimiter) Allow(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return l.allowAt(key, limit, window, time.Now())
+}
+
+func (l *RateLimiter) allowAt(key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+	windowStart := now.Truncate(window)
+	currentKey := key + ":" + windowStart.Format(time.RFC3339)
+	previousKey := key + ":" + windowStart.Add(-window).Format(time.RFC3339)
+
+	current, err := l.store.Increment(currentKey, windowStart.Add(2*window))
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	previous, err := l.store.Get(previousKey)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	elapsed := float64(now.Sub(windowStart)) / float64(window)
+	estimate := float64(previous)*(1-elapsed) + float64(current)
+
+	remaining := limit - int(math.Ceil(estimate))
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return RateLimitResult{
+		Allowed:   estimate <= float64(limit),
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     windowStart.Add(window).Sub(now),
+	}, nil
+}
+
+// MemoryRateLimitStore - Per-process counters
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	counters  map[string]models.RateLimitCounter
+	lastPurge time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{counters: make(map[string]models.RateLimitCounter)}
+}
+
+func (s *MemoryRateLimitStore) Increment(key string, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) > time.Minute {
+		for k, counter := range s.counters {
+			if counter.ExpiresAt.Before(now) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	counter := s.counters[key]
+	counter.Key = key
+	counter.Count++
+	counter.ExpiresAt = expiresAt
+	s.counters[key] = counter
+	return counter.Count, nil
+}
+
+func (s *MemoryRateLimitStore) Get(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[key].Count, nil
+}
+
+// PostgresRateLimitStore - Counters shared by all instances via rate_limit_counters
+type PostgresRateLimitStore struct {
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewPostgresRateLimitStore() *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{}
+}
+
+func (s *PostgresRateLimitStore) Increment(key string, expiresAt time.Time) (int64, error) {
+	s.purgeExpired()
+
+	var count int64
+	err := config.DB.Raw(`
+		INSERT INTO rate_limit_counters (key, count, expires_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET count = rate_limit_counters.count + 1
+		RETURNING count`, key, expiresAt).Scan(&count).Error
+	return count, err
+}
+
+func (s *PostgresRateLimitStore) Get(key string) (int64, error) {
+	var counter models.RateLimitCounter
+	err := config.DB.Where("key = ?", key).Limit(1).Find(&counter).Error
+	return counter.Count, err
+}
+
+// purgeExpired - Delete expired counters at most once per minute per instance
+func (s *PostgresRateLimitStore) purgeExpired() {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastPurge) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+
+	if err := config.DB.Where("expires_at < ?", now).Delete(&models.RateLimitCounter{}).Error; err != nil {
+		log.Printf("Failed to purge rate limit counters: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore())
+	window := time.Minute
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// 4 requests at the start of a window with a limit of 4
+	for i := 0; i < 4; i++ {
+		result, err := limiter.allowAt("client", 4, window, start.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != 3-i {
+			t.Fatalf("request %d: got %+v, want allowed with %d remaining", i+1, result, 3-i)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		at            time.Duration // after start
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+	}{
+		// 5 in the current window
+		{name: "over the limit", at: 10 * time.Second, wantReset: 50 * time.Second},
+		// A quarter into the next window, 3/4 of the previous 5 still count: 3.75 + 1
+		{name: "previous window still weighs", at: window + 15*time.Second, wantReset: 45 * time.Second},
+		// Halfway, 5/2 + 2 = 4.5
+		{name: "halfway through the next window", at: window + 30*time.Second, wantReset: 30 * time.Second},
+		// 5/10 + 3 = 3.5
+		{name: "previous window mostly passed", at: window + 54*time.Second, wantAllowed: true, wantRemaining: 0, wantReset: 6 * time.Second},
+		// Two windows later nothing of the first one is left
+		{name: "window after next", at: 3 * window, wantAllowed: true, wantRemaining: 3, wantReset: window},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := limiter.allowAt("client", 4, window, start.Add(tt.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining || result.Reset != tt.wantReset || result.Limit != 4 {
+				t.Errorf("got %+v, want allowed %v remaining %d reset %s", result, tt.wantAllowed, tt.wantRemaining, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSeparatesKeys(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if result, _ := limiter.allowAt("a", 1, time.Minute, now); !result.Allowed {
+		t.Fatal("first request of a denied")
+	}
+	if result, _ := limiter.allowAt("a", 1, time.Minute, now); result.Allowed {
+		t.Error("second request of a allowed")
+	}
+	if result, _ := limiter.allowAt("b", 1, time.Minute, now); !result.Allowed {
+		t.Error("first request of b denied")
+	}
+}
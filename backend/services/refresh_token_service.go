@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// RefreshTokenLifetime - Refresh tokens expire after 7 days
+const RefreshTokenLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type RefreshTokenService struct{}
+
+func NewRefreshTokenService() *RefreshTokenService {
+	return &RefreshTokenService{}
+}
+
+// Issue - Create a new refresh token. Empty familyID starts a new family.
+func (s *RefreshTokenService) Issue(userID uint, familyID string) (string, *models.RefreshToken, error) {
+	return s.issue(config.DB, userID, familyID)
+}
+
+func (s *RefreshTokenService) issue(db *gorm.DB, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	if familyID == "" {
+		familyID = utils.NewTokenID()
+	}
+
+	raw := utils.GenerateOpaqueToken()
+	record := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(RefreshTokenLifetime),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+
+	return raw, &record, nil
+}
+
+// Rotate - Consume a refresh token and issue its successor in the same family.
+// Presenting an already used token revokes the whole family.
+func (s *RefreshTokenService) Rotate(raw string) (string, *models.RefreshToken, error) {
+	var current models.RefreshToken
+	if err := config.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&current).Error; err != nil {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+
+	if err := checkRotatable(current, time.Now()); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			s.handleReuse(current)
+		}
+		return "", nil, err
+	}
+
+	var newRaw string
+	var next *models.RefreshToken
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional update so two concurrent refreshes cannot both succeed
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", current.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		newRaw, next, err = s.issue(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", current.ID).Update("replaced_by", next.ID).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		s.handleReuse(current)
+		return "", nil, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return newRaw, next, nil
+}
+
+// checkRotatable - A used token is reported as reused even when it has since
+// been revoked or has expired, so that replaying it still revokes the family
+func checkRotatable(token models.RefreshToken, now time.Time) error {
+	if token.UsedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	if token.RevokedAt != nil || token.ExpiresAt.Before(now) {
+		return ErrRefreshTokenInvalid
+	}
+	return nil
+}
+
+func (s *RefreshTokenService) handleReuse(token models.RefreshToken) {
+	log.Printf("SECURITY: refresh token reuse detected for user %d, revoking family %s", token.UserID, token.FamilyID)
+	if err := NewSessionService().RevokeFamily(token.FamilyID); err != nil {
+		log.Printf("Failed to revoke token family %s: %v", token.FamilyID, err)
+	}
+}
+
+// Lookup - Find refresh token record by its raw value
+func (s *RefreshTokenService) Lookup(raw string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := config.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeFamily - Revoke every refresh token in a family
+func (s *RefreshTokenService) RevokeFamily(familyID string) error {
+	return config.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser - Revoke every refresh token belonging to a user, except
+// those of keepFamilyID (empty = none)
+func (s *RefreshTokenService) RevokeAllForUser(db *gorm.DB, userID uint, keepFamilyID string) error {
+	query := db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepFamilyID != "" {
+		query = query.Where("family_id <> ?", keepFamilyID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
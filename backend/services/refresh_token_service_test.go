@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestCheckRotatable(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		token models.RefreshToken
+		want  error
+	}{
+		{name: "fresh", token: models.RefreshToken{ExpiresAt: now.Add(time.Hour)}},
+		{name: "used", token: models.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier}, want: ErrRefreshTokenReused},
+		{name: "revoked", token: models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &earlier}, want: ErrRefreshTokenInvalid},
+		{name: "expired", token: models.RefreshToken{ExpiresAt: earlier}, want: ErrRefreshTokenInvalid},
+		{name: "used and revoked", token: models.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier, RevokedAt: &earlier}, want: ErrRefreshTokenReused},
+		{name: "used and expired", token: models.RefreshToken{ExpiresAt: earlier, UsedAt: &earlier}, want: ErrRefreshTokenReused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRotatable(tt.token, now); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// InvitationLifetime - Invitations expire after 7 days
+const InvitationLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrRoleNotAllowed         = errors.New("requested role is not available for self-registration")
+	ErrDefaultRoleMissing     = errors.New("default registration role not found")
+	ErrInvalidInvitation      = errors.New("invalid or expired invitation")
+	ErrInvitationNotFound     = errors.New("invitation not found")
+	ErrEmailAlreadyRegistered = errors.New("email already registered")
+)
+
+// DefaultRegistrationRole - Role given to public registrations
+// (REGISTRATION_DEFAULT_ROLE, default "user")
+func DefaultRegistrationRole() string {
+	if role := os.Getenv("REGISTRATION_DEFAULT_ROLE"); role != "" {
+		return role
+	}
+	return "user"
+}
+
+// RegistrationAllowedRoles - Roles public registration may request besides the
+// default role (REGISTRATION_ALLOWED_ROLES, comma separated, empty by default)
+func RegistrationAllowedRoles() []string {
+	var roles []string
+	for _, role := range strings.Split(os.Getenv("REGISTRATION_ALLOWED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// RegistrationService - Decides which role a new account gets. Public
+// registration only gets the default role or one on the allow-list, any other
+// role requires an admin to create the user or send an invitation.
+type RegistrationService struct{}
+
+func NewRegistrationService() *RegistrationService {
+	return &RegistrationService{}
+}
+
+// ResolveRole - Role for a public registration. requestedRoleID 0 means the
+// default role, anything else must be on the allow-list.
+func (s *RegistrationService) ResolveRole(requestedRoleID uint) (*models.Role, error) {
+	var role models.Role
+	if requestedRoleID == 0 {
+		if err := config.DB.Where("name = ?", DefaultRegistrationRole()).First(&role).Error; err != nil {
+			return nil, ErrDefaultRoleMissing
+		}
+		return &role, nil
+	}
+
+	if err := config.DB.First(&role, requestedRoleID).Error; err != nil {
+		return nil, ErrRoleNotAllowed
+	}
+	if role.Name == DefaultRegistrationRole() {
+		return &role, nil
+	}
+	for _, allowed := range RegistrationAllowedRoles() {
+		if role.Name == allowed {
+			return &role, nil
+		}
+	}
+	return nil, ErrRoleNotAllowed
+}
+
+// Register - Create an account. With an invitation token the invited role is
+// used and the email counts as verified, since the token was delivered to it.
+// Other accounts start as pending when registration requires approval.
+func (s *RegistrationService) Register(name, email, passwordHash string, requestedRoleID uint, invitationToken string) (*models.User, error) {
+	user := models.User{
+		Name:     name,
+		Email:    email,
+		Password: passwordHash,
+		Status:   models.AccountStatusActive,
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if invitationToken != "" {
+			invitation, err := s.acceptInvitation(tx, invitationToken, email)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			user.RoleID = invitation.RoleID
+			user.EmailVerifiedAt = &now
+		} else {
+			role, err := s.ResolveRole(requestedRoleID)
+			if err != nil {
+				return err
+			}
+			user.RoleID = role.ID
+			if RegistrationRequiresApproval() {
+				user.Status = models.AccountStatusPending
+			}
+		}
+
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// acceptInvitation - Atomically mark an open invitation for email as accepted
+func (s *RegistrationService) acceptInvitation(tx *gorm.DB, raw, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	now := time.Now()
+	result := tx.Raw(`
+		UPDATE invitations SET accepted_at = ?
+		WHERE token_hash = ? AND lower(email) = lower(?)
+			AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?
+		RETURNING *`, now, utils.HashToken(raw), email, now).Scan(&invitation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+// Invite - Invite an email address to register with a role and send the link.
+// Earlier open invitations for the same address are revoked.
+func (s *RegistrationService) Invite(email string, roleID uint, inviter *models.User) (*models.Invitation, error) {
+	var count int64
+	config.DB.Model(&models.User{}).Where("lower(email) = lower(?)", email).Count(&count)
+	if count > 0 {
+		return nil, ErrEmailAlreadyRegistered
+	}
+
+	var role models.Role
+	if err := config.DB.First(&role, roleID).Error; err != nil {
+		return nil, ErrRoleNotFound
+	}
+
+	raw := utils.GenerateOpaqueToken()
+	invitation := models.Invitation{
+		Email:     email,
+		RoleID:    role.ID,
+		InvitedBy: inviter.ID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(InvitationLifetime),
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Invitation{}).
+			Where("lower(email) = lower(?) AND accepted_at IS NULL AND revoked_at IS NULL", email).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	link := AppURL() + "/register?invitation=" + url.QueryEscape(raw) + "&email=" + url.QueryEscape(email)
+	if err := mailer.Default().SendInvitation(email, inviter.Name, role.Name, link, "7 days"); err != nil {
+		return nil, err
+	}
+
+	invitation.Role = role
+	return &invitation, nil
+}
+
+// ListInvitations - All invitations, newest first
+func (s *RegistrationService) ListInvitations() ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := config.DB.Preload("Role").Order("created_at DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+// RevokeInvitation - Withdraw an invitation that was not accepted yet
+func (s *RegistrationService) RevokeInvitation(id uint) error {
+	result := config.DB.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// MaxTokenLifetime - Longest lifetime of any issued JWT. A user-wide
+// revocation only needs to be remembered this long.
+const MaxTokenLifetime = 24 * time.Hour
+
+// tokenLockClass - First key of the pg_advisory_xact_lock(int, int) locks
+// that serialize consuming a single-use token, the second is the hashed jti
+const tokenLockClass = 7301
+
+// ErrTokenUsed - A single-use token was consumed before
+var ErrTokenUsed = errors.New("token has already been used")
+
+// revocationCache - In-memory mirror of the revoked_tokens table
+type revocationCache struct {
+	mu         sync.RWMutex
+	tokens     map[string]time.Time // jti -> token expiry
+	sessions   map[uint]time.Time   // sessionID -> revocation expiry
+	users      map[uint]time.Time   // userID -> tokens issued before this are revoked
+	lastSynced time.Time
+}
+
+var revocations = &revocationCache{
+	tokens:   make(map[string]time.Time),
+	sessions: make(map[uint]time.Time),
+	users:    make(map[uint]time.Time),
+}
+
+type RevocationService struct{}
+
+func NewRevocationService() *RevocationService {
+	return &RevocationService{}
+}
+
+// LoadRevocations - Load denylist from database and keep it in sync
+func (s *RevocationService) LoadRevocations(interval time.Duration) {
+	if err := s.sync(); err != nil {
+		log.Printf("Failed to load revoked tokens: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.sync(); err != nil {
+				log.Printf("Failed to sync revoked tokens: %v", err)
+			}
+			s.purgeExpired()
+		}
+	}()
+}
+
+// sync - Pull rows created since the last sync so revocations made by other
+// instances are picked up
+func (s *RevocationService) sync() error {
+	revocations.mu.RLock()
+	since := revocations.lastSynced
+	revocations.mu.RUnlock()
+
+	now := time.Now()
+	var rows []models.RevokedToken
+	if err := config.DB.Where("created_at >= ? AND expires_at > ?", since, now).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	for _, row := range rows {
+		revocations.add(row)
+	}
+	revocations.lastSynced = now.Add(-time.Minute) // overlap to tolerate clock skew
+	return nil
+}
+
+func (r *revocationCache) add(row models.RevokedToken) {
+	if row.JTI != "" {
+		r.tokens[row.JTI] = row.ExpiresAt
+		return
+	}
+	if row.SessionID != 0 {
+		r.sessions[row.SessionID] = row.ExpiresAt
+		return
+	}
+	if row.CreatedAt.After(r.users[row.UserID]) {
+		r.users[row.UserID] = row.CreatedAt
+	}
+}
+
+// purgeExpired - Drop entries whose tokens have already expired
+func (s *RevocationService) purgeExpired() {
+	now := time.Now()
+
+	revocations.mu.Lock()
+	for jti, exp := range revocations.tokens {
+		if exp.Before(now) {
+			delete(revocations.tokens, jti)
+		}
+	}
+	for sessionID, exp := range revocations.sessions {
+		if exp.Before(now) {
+			delete(revocations.sessions, sessionID)
+		}
+	}
+	for userID, revokedAt := range revocations.users {
+		if revokedAt.Add(MaxTokenLifetime).Before(now) {
+			delete(revocations.users, userID)
+		}
+	}
+	revocations.mu.Unlock()
+
+	config.DB.Where("expires_at <= ?", now).Delete(&models.RevokedToken{})
+}
+
+// RevokeToken - Add a single token to the denylist
+func (s *RevocationService) RevokeToken(claims *utils.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+
+	row := models.RevokedToken{
+		JTI:    claims.ID,
+		UserID: claims.UserID,
+	}
+	if claims.ExpiresAt != nil {
+		row.ExpiresAt = claims.ExpiresAt.Time
+	} else {
+		row.ExpiresAt = time.Now().Add(MaxTokenLifetime)
+	}
+
+	if err := config.DB.Create(&row).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.add(row)
+	revocations.mu.Unlock()
+	return nil
+}
+
+// ConsumeToken - Revoke a single-use token, ErrTokenUsed when it was revoked
+// before. Concurrent calls for the same token are serialized, so only one of
+// them succeeds.
+func (s *RevocationService) ConsumeToken(claims *utils.Claims) error {
+	if claims.ID == "" {
+		return ErrTokenUsed
+	}
+
+	row := models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: time.Now().Add(MaxTokenLifetime),
+	}
+	if claims.ExpiresAt != nil {
+		row.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", tokenLockClass, claims.ID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTokenUsed
+		}
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.add(row)
+	revocations.mu.Unlock()
+	return nil
+}
+
+// RevokeSession - Revoke every access token carrying the session ID
+func (s *RevocationService) RevokeSession(userID, sessionID uint) error {
+	row := models.RevokedToken{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(MaxTokenLifetime),
+	}
+	if err := config.DB.Create(&row).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.add(row)
+	revocations.mu.Unlock()
+	return nil
+}
+
+// RevokeAllForUser - Revoke every session, access, refresh and personal access token issued to the user up to now
+func (s *RevocationService) RevokeAllForUser(userID uint) error {
+	return s.RevokeAllForUserExcept(userID, 0)
+}
+
+// RevokeAllForUserExcept - RevokeAllForUser, but the session keepSessionID
+// stays signed in through its refresh tokens. Its access tokens issued up to
+// now are revoked as well, the caller hands out a new one.
+func (s *RevocationService) RevokeAllForUserExcept(userID, keepSessionID uint) error {
+	var row *models.RevokedToken
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		row, err = s.RevokeAllForUserTx(tx, userID, keepSessionID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Remember(row)
+	return nil
+}
+
+// RevokeAllForUserTx - RevokeAllForUserExcept within the caller's transaction,
+// so that the revocation commits or fails together with the change that caused
+// it. Pass the returned row to Remember after the commit.
+func (s *RevocationService) RevokeAllForUserTx(tx *gorm.DB, userID, keepSessionID uint) (*models.RevokedToken, error) {
+	var keepFamilyID string
+	sessions := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepSessionID != 0 {
+		var session models.Session
+		if err := tx.Where("id = ? AND user_id = ?", keepSessionID, userID).First(&session).Error; err != nil {
+			return nil, err
+		}
+		keepFamilyID = session.FamilyID
+		sessions = sessions.Where("id <> ?", keepSessionID)
+	}
+
+	if err := NewRefreshTokenService().RevokeAllForUser(tx, userID, keepFamilyID); err != nil {
+		return nil, err
+	}
+
+	if err := NewPersonalAccessTokenService().RevokeAllForUser(tx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := sessions.Update("revoked_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	row := models.RevokedToken{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(MaxTokenLifetime),
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// Remember - Add a committed denylist row to the cache of this instance,
+// other instances pick it up on their next sync
+func (s *RevocationService) Remember(row *models.RevokedToken) {
+	revocations.mu.Lock()
+	revocations.add(*row)
+	revocations.mu.Unlock()
+}
+
+// IsRevoked - Check token against the in-memory denylist
+func (s *RevocationService) IsRevoked(claims *utils.Claims) bool {
+	revocations.mu.RLock()
+	defer revocations.mu.RUnlock()
+
+	if _, ok := revocations.tokens[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+
+	if _, ok := revocations.sessions[claims.SessionID]; ok && claims.SessionID != 0 {
+		return true
+	}
+
+	if revocations.userRevoked(claims.UserID, claims) {
+		return true
+	}
+
+	// Revoking the admin also ends the impersonation tokens they hold
+	if actorID := claims.ActorID(); actorID != 0 && revocations.userRevoked(actorID, claims) {
+		return true
+	}
+
+	return false
+}
+
+// userRevoked - Whether all tokens of userID issued before claims were revoked
+func (r *revocationCache) userRevoked(userID uint, claims *utils.Claims) bool {
+	revokedAt, ok := r.users[userID]
+	if !ok {
+		return false
+	}
+	// Tokens without iat predate revocation support. iat has whole seconds,
+	// every token of the second of the revocation counts as revoked.
+	return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(revokedAt)
+}
+
+// IssuedAt - iat for a new access token of userID. A token issued in the
+// same second as a user-wide revocation (e.g. the replacement token after a
+// password change) is dated to the next second so that it stays valid.
+func (s *RevocationService) IssuedAt(userID uint) time.Time {
+	now := time.Now()
+
+	revocations.mu.RLock()
+	revokedAt, ok := revocations.users[userID]
+	revocations.mu.RUnlock()
+
+	if ok && !now.Truncate(time.Second).After(revokedAt) {
+		return revokedAt.Truncate(time.Second).Add(time.Second)
+	}
+	return now
+}
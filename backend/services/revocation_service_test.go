@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// revokeUserAt - Put a user-wide revocation into the cache
+func revokeUserAt(t *testing.T, userID uint, at time.Time) {
+	t.Helper()
+	revocations.mu.Lock()
+	revocations.users[userID] = at
+	revocations.mu.Unlock()
+	t.Cleanup(func() {
+		revocations.mu.Lock()
+		delete(revocations.users, userID)
+		revocations.mu.Unlock()
+	})
+}
+
+func claimsIssuedAt(userID uint, iat *time.Time) *utils.Claims {
+	claims := &utils.Claims{UserID: userID}
+	if iat != nil {
+		claims.IssuedAt = jwt.NewNumericDate(*iat)
+	}
+	return claims
+}
+
+func TestUserRevoked(t *testing.T) {
+	revokedAt := time.Date(2026, 6, 1, 10, 0, 0, 500_000_000, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := revokedAt.Truncate(time.Second).Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+		iat    *time.Time
+		want   bool
+	}{
+		{name: "issued a second before", userID: 1, iat: at(-time.Second), want: true},
+		// iat is truncated to whole seconds, the token may predate the revocation
+		{name: "issued in the same second", userID: 1, iat: at(0), want: true},
+		{name: "issued the next second", userID: 1, iat: at(time.Second)},
+		{name: "without iat", userID: 1, want: true},
+		{name: "other user", userID: 2, iat: at(-time.Second)},
+	}
+
+	revokeUserAt(t, 1, revokedAt)
+	service := NewRevocationService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.IsRevoked(claimsIssuedAt(tt.userID, tt.iat)); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuedAtAfterRevocation(t *testing.T) {
+	service := NewRevocationService()
+
+	tests := []struct {
+		name      string
+		revokedAt time.Time
+	}{
+		{name: "revoked just now", revokedAt: time.Now()},
+		{name: "revoked a minute ago", revokedAt: time.Now().Add(-time.Minute)},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uint(100 + i)
+			revokeUserAt(t, userID, tt.revokedAt)
+
+			issuedAt := service.IssuedAt(userID)
+			if service.IsRevoked(claimsIssuedAt(userID, &issuedAt)) {
+				t.Errorf("token issued at %s is revoked by revocation at %s", issuedAt, tt.revokedAt)
+			}
+			if issuedAt.Sub(time.Now()) > time.Second {
+				t.Errorf("iat %s is more than a second ahead", issuedAt)
+			}
+		})
+	}
+
+	if issuedAt := service.IssuedAt(999); time.Since(issuedAt) > time.Second {
+		t.Errorf("iat %s of a user without revocation is not now", issuedAt)
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"errors"
+
+	"backend/config"
+	"backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNameTaken       = errors.New("role name already exists")
+	ErrRoleInUse           = errors.New("role still has users or service accounts, choose a role to reassign them to")
+	ErrInvalidReassignRole = errors.New("users cannot be reassigned to the deleted role or an unknown role")
+	ErrLastAdminRole       = errors.New("cannot remove the last role that can manage roles")
+	ErrPermissionNameTaken = errors.New("permission name already exists")
+	ErrPermissionBuiltin   = errors.New("built-in permissions cannot be deleted")
+	ErrRoleCycle           = errors.New("parent role would create a cycle in the role hierarchy")
+)
+
+// RoleService - Manage roles, permissions and their assignments. Every change
+// invalidates the permission cache.
+type RoleService struct {
+	permissions *PermissionService
+}
+
+func NewRoleService() *RoleService {
+	return &RoleService{permissions: NewPermissionService()}
+}
+
+// ListRoles - All roles with their permissions and number of users
+func (s *RoleService) ListRoles() ([]models.Role, map[uint]int64, error) {
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions.Permission").Order("id").Find(&roles).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var counts []struct {
+		RoleID uint
+		Count  int64
+	}
+	err := config.DB.Model(&models.User{}).
+		Select("role_id, count(*) AS count").
+		Group("role_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		userCounts[count.RoleID] = count.Count
+	}
+	return roles, userCounts, nil
+}
+
+// GetRole - One role with its permissions
+func (s *RoleService) GetRole(id uint) (*models.Role, error) {
+	var role models.Role
+	if err := config.DB.Preload("Permissions.Permission").First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CountUsers - Number of users assigned to a role
+func (s *RoleService) CountUsers(roleID uint) (int64, error) {
+	var count int64
+	err := config.DB.Model(&models.User{}).Where("role_id = ?", roleID).Count(&count).Error
+	return count, err
+}
+
+// CreateRole - Create a role, optionally below a parent role and granting
+// permissions by name
+func (s *RoleService) CreateRole(name string, parentID *uint, permissionNames []string) (*models.Role, error) {
+	if s.roleNameTaken(name, 0) {
+		return nil, ErrRoleNameTaken
+	}
+	if parentID != nil {
+		if err := config.DB.First(&models.Role{}, *parentID).Error; err != nil {
+			return nil, ErrRoleNotFound
+		}
+	}
+
+	permissions, err := s.permissionsByName(permissionNames)
+	if err != nil {
+		return nil, err
+	}
+
+	role := models.Role{Name: name, ParentID: parentID}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			if err := tx.Create(&models.RolePermission{RoleID: role.ID, PermissionID: permission.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.permissions.Invalidate()
+	return s.GetRole(role.ID)
+}
+
+// RenameRole - Change the name of a role. Tokens issued before still carry the
+// old name, authorization does not use it: callers are resolved to the current
+// role of their user or service account.
+func (s *RoleService) RenameRole(id uint, name string) (*models.Role, error) {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == name {
+		return role, nil
+	}
+	if s.roleNameTaken(name, id) {
+		return nil, ErrRoleNameTaken
+	}
+
+	if err := config.DB.Model(role).Update("name", name).Error; err != nil {
+		return nil, err
+	}
+
+	s.permissions.Invalidate()
+	NewAccountStatusService().InvalidateAll()
+	NewServiceAccountService().InvalidateAll()
+	return s.GetRole(id)
+}
+
+// SetParent - Move a role below another role, nil makes it a root role.
+// Rejects changes that would create a cycle or leave nobody able to manage roles.
+func (s *RoleService) SetParent(id uint, parentID *uint) (*models.Role, error) {
+	graph, err := loadRoleGraph()
+	if err != nil {
+		return nil, err
+	}
+	role, ok := graph.roles[id]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	if parentID != nil {
+		if _, ok := graph.roles[*parentID]; !ok {
+			return nil, ErrRoleNotFound
+		}
+		if graph.createsCycle(id, *parentID) {
+			return nil, ErrRoleCycle
+		}
+	}
+
+	role.ParentID = parentID
+	if s.removesLastAdmin(graph, func(g *roleGraph) { g.roles[id] = role }) {
+		return nil, ErrLastAdminRole
+	}
+
+	if err := config.DB.Model(&models.Role{}).Where("id = ?", id).Update("parent_id", parentID).Error; err != nil {
+		return nil, err
+	}
+
+	s.permissions.Invalidate()
+	return s.GetRole(id)
+}
+
+// EffectivePermissions - Permissions of a role including inherited ones
+func (s *RoleService) EffectivePermissions(id uint) ([]EffectivePermission, error) {
+	return s.permissions.EffectivePermissions(id)
+}
+
+// DeleteRole - Delete a role. Users and service accounts of the role are moved
+// to reassignTo, which is required when the role is still in use.
+func (s *RoleService) DeleteRole(id, reassignTo uint) error {
+	graph, err := loadRoleGraph()
+	if err != nil {
+		return err
+	}
+	role, ok := graph.roles[id]
+	if !ok {
+		return ErrRoleNotFound
+	}
+
+	// Child roles move up to the parent of the deleted role
+	removeRole := func(g *roleGraph) {
+		for childID, child := range g.roles {
+			if child.ParentID != nil && *child.ParentID == id {
+				child.ParentID = role.ParentID
+				g.roles[childID] = child
+			}
+		}
+		delete(g.roles, id)
+	}
+	if s.removesLastAdmin(graph, removeRole) {
+		return ErrLastAdminRole
+	}
+
+	userCount, err := s.CountUsers(id)
+	if err != nil {
+		return err
+	}
+	var serviceAccountCount int64
+	if err := config.DB.Model(&models.ServiceAccount{}).Where("role_id = ?", id).Count(&serviceAccountCount).Error; err != nil {
+		return err
+	}
+	if userCount > 0 || serviceAccountCount > 0 {
+		if reassignTo == 0 {
+			return ErrRoleInUse
+		}
+		if reassignTo == id {
+			return ErrInvalidReassignRole
+		}
+		if err := config.DB.First(&models.Role{}, reassignTo).Error; err != nil {
+			return ErrInvalidReassignRole
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if userCount > 0 {
+			// Soft deleted users too, so restoring them never points at a missing role
+			if err := tx.Unscoped().Model(&models.User{}).Where("role_id = ?", id).Update("role_id", reassignTo).Error; err != nil {
+				return err
+			}
+		}
+		if serviceAccountCount > 0 {
+			if err := tx.Model(&models.ServiceAccount{}).Where("role_id = ?", id).Update("role_id", reassignTo).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Role{}).Where("parent_id = ?", id).Update("parent_id", role.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		// Hard delete so the name can be used again. Outstanding tokens naming
+		// the role do not pick up a new role of that name, callers are resolved
+		// to the role they were reassigned to.
+		return tx.Unscoped().Delete(&models.Role{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.permissions.Invalidate()
+	NewAccountStatusService().InvalidateAll()
+	NewServiceAccountService().InvalidateAll()
+	return nil
+}
+
+// AttachPermission - Grant a permission to a role
+func (s *RoleService) AttachPermission(roleID, permissionID uint) error {
+	return s.permissions.Grant(roleID, permissionID)
+}
+
+// DetachPermission - Take a permission away from a role
+func (s *RoleService) DetachPermission(roleID, permissionID uint) error {
+	var permission models.Permission
+	if err := config.DB.First(&permission, permissionID).Error; err != nil {
+		return ErrPermissionNotFound
+	}
+
+	if permission.Name == models.PermRolesWrite {
+		graph, err := loadRoleGraph()
+		if err != nil {
+			return err
+		}
+		removeGrant := func(g *roleGraph) {
+			var kept []string
+			for _, name := range g.direct[roleID] {
+				if name != permission.Name {
+					kept = append(kept, name)
+				}
+			}
+			g.direct[roleID] = kept
+		}
+		if s.removesLastAdmin(graph, removeGrant) {
+			return ErrLastAdminRole
+		}
+	}
+
+	return s.permissions.Revoke(roleID, permissionID)
+}
+
+// ListPermissions - All permissions
+func (s *RoleService) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := config.DB.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+// CreatePermission - Create a permission that can be granted to roles
+func (s *RoleService) CreatePermission(name, description string) (*models.Permission, error) {
+	var count int64
+	config.DB.Unscoped().Model(&models.Permission{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return nil, ErrPermissionNameTaken
+	}
+
+	permission := models.Permission{Name: name, Description: description}
+	if err := config.DB.Create(&permission).Error; err != nil {
+		return nil, err
+	}
+	return &permission, nil
+}
+
+// UpdatePermission - Change the description of a permission. Names are
+// referenced by routes and are not renamed.
+func (s *RoleService) UpdatePermission(id uint, description string) (*models.Permission, error) {
+	var permission models.Permission
+	if err := config.DB.First(&permission, id).Error; err != nil {
+		return nil, ErrPermissionNotFound
+	}
+
+	if err := config.DB.Model(&permission).Update("description", description).Error; err != nil {
+		return nil, err
+	}
+	return &permission, nil
+}
+
+// DeletePermission - Delete a custom permission and its assignments
+func (s *RoleService) DeletePermission(id uint) error {
+	var permission models.Permission
+	if err := config.DB.First(&permission, id).Error; err != nil {
+		return ErrPermissionNotFound
+	}
+
+	for _, builtin := range models.BuiltinPermissions {
+		if permission.Name == builtin {
+			return ErrPermissionBuiltin
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("permission_id = ?", id).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Permission{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.permissions.Invalidate()
+	return nil
+}
+
+// removesLastAdmin - Whether applying change to the role graph leaves no role
+// with roles:write, so nobody could manage roles anymore
+func (s *RoleService) removesLastAdmin(graph *roleGraph, change func(g *roleGraph)) bool {
+	if !graph.anyRoleHas(models.PermRolesWrite) {
+		return false
+	}
+	change(graph)
+	return !graph.anyRoleHas(models.PermRolesWrite)
+}
+
+func (s *RoleService) roleNameTaken(name string, exceptID uint) bool {
+	var count int64
+	config.DB.Model(&models.Role{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count)
+	return count > 0
+}
+
+func (s *RoleService) permissionsByName(names []string) ([]models.Permission, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var permissions []models.Permission
+	if err := config.DB.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, ErrPermissionNotFound
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"html"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"backend/config"
+	"backend/models"
+)
+
+// User search limits
+const (
+	DefaultUserSearchLimit = 20
+	MaxUserSearchLimit     = 50
+)
+
+// Search backends
+const (
+	SearchBackendFullText = "fulltext"
+	SearchBackendILike    = "ilike"
+)
+
+// UserSearchResult - One matching user with its rank and highlighted fields.
+// Highlights are HTML escaped with matches wrapped in <mark>.
+type UserSearchResult struct {
+	User       models.User       `json:"user"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchService - Ranked user search by name and email. Uses the tsvector and
+// pg_trgm indexes from migrations/000001_user_search when they exist and falls
+// back to ILIKE otherwise (USER_SEARCH_BACKEND=fulltext|ilike forces one).
+type SearchService struct{}
+
+func NewSearchService() *SearchService {
+	return &SearchService{}
+}
+
+var (
+	searchBackendOnce sync.Once
+	searchBackend     string
+)
+
+// Backend - Search backend in use, detected once on first use
+func (s *SearchService) Backend() string {
+	searchBackendOnce.Do(func() {
+		switch os.Getenv("USER_SEARCH_BACKEND") {
+		case SearchBackendFullText:
+			searchBackend = SearchBackendFullText
+		case SearchBackendILike:
+			searchBackend = SearchBackendILike
+		default:
+			searchBackend = detectSearchBackend()
+		}
+	})
+	return searchBackend
+}
+
+// detectSearchBackend - Full-text search needs pg_trgm and users.search_vector
+func detectSearchBackend() string {
+	var available bool
+	err := config.DB.Raw(`
+		SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')
+			AND EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'search_vector')`).
+		Scan(&available).Error
+	if err != nil || !available {
+		return SearchBackendILike
+	}
+	return SearchBackendFullText
+}
+
+// SearchUsers - Users matching query, best matches first
+func (s *SearchService) SearchUsers(query string, limit int) ([]UserSearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultUserSearchLimit
+	}
+	if limit > MaxUserSearchLimit {
+		limit = MaxUserSearchLimit
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []UserSearchResult{}, nil
+	}
+
+	var ranked []rankedUser
+	var err error
+	if s.Backend() == SearchBackendFullText {
+		ranked, err = s.searchFullText(query, terms, limit)
+	} else {
+		ranked, err = s.searchILike(query, terms, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.loadResults(ranked, terms)
+}
+
+type rankedUser struct {
+	ID   uint
+	Rank float64
+}
+
+// searchFullText - Prefix full-text match on name (weight A) and email
+// (weight B), plus trigram similarity (pg_trgm %, threshold
+// pg_trgm.similarity_threshold) so that typos still match
+func (s *SearchService) searchFullText(query string, terms []string, limit int) ([]rankedUser, error) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	tsquery := strings.Join(prefixes, " & ")
+	needle := strings.ToLower(strings.TrimSpace(query))
+
+	var ranked []rankedUser
+	err := config.DB.Raw(`
+		SELECT id, ts_rank(search_vector, to_tsquery('simple', @tsquery))
+				+ greatest(similarity(name, @needle), similarity(email, @needle)) AS rank
+		FROM users
+		WHERE deleted_at IS NULL
+			AND (search_vector @@ to_tsquery('simple', @tsquery) OR name % @needle OR email % @needle)
+		ORDER BY rank DESC, id
+		LIMIT @limit`,
+		map[string]interface{}{"tsquery": tsquery, "needle": needle, "limit": limit}).
+		Scan(&ranked).Error
+	return ranked, err
+}
+
+// searchILike - Every term must occur in name or email. Exact matches rank
+// above prefix matches, which rank above matches anywhere.
+func (s *SearchService) searchILike(query string, terms []string, limit int) ([]rankedUser, error) {
+	needle := escapeLike(strings.TrimSpace(query))
+	db := config.DB.Model(&models.User{}).
+		Select(`id, CASE
+			WHEN name ILIKE ? OR email ILIKE ? THEN 3
+			WHEN name ILIKE ? OR email ILIKE ? THEN 2
+			ELSE 1 END AS rank`, needle, needle, needle+"%", needle+"%")
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		db = db.Where("(name ILIKE ? OR email ILIKE ?)", pattern, pattern)
+	}
+
+	var ranked []rankedUser
+	err := db.Order("rank DESC, id").Limit(limit).Scan(&ranked).Error
+	return ranked, err
+}
+
+// loadResults - Load the ranked users with their role, keeping the rank order
+func (s *SearchService) loadResults(ranked []rankedUser, terms []string) ([]UserSearchResult, error) {
+	results := make([]UserSearchResult, 0, len(ranked))
+	if len(ranked) == 0 {
+		return results, nil
+	}
+
+	ids := make([]uint, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.ID
+	}
+	var users []models.User
+	if err := config.DB.Preload("Role").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	for _, r := range ranked {
+		user, ok := byID[r.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, UserSearchResult{
+			User: user,
+			Rank: r.Rank,
+			Highlights: map[string]string{
+				"name":  highlightTerms(user.Name, terms),
+				"email": highlightTerms(user.Email, terms),
+			},
+		})
+	}
+	return results, nil
+}
+
+// searchTerms - Lowercase words of the query, punctuation acts as separator
+// so that terms are safe to use in a tsquery
+func searchTerms(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	var terms []string
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// highlightTerms - HTML escape text and wrap case-insensitive occurrences of
+// terms in <mark>. Overlapping matches are merged.
+func highlightTerms(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length, offsets would not line up
+		return html.EscapeString(text)
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		needle := []rune(term)
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == term {
+				spans = append(spans, span{i, i + len(needle)})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return html.EscapeString(text)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i].start, spans[i].end
+		for i++; i < len(spans) && spans[i].start <= end; i++ {
+			if spans[i].end > end {
+				end = spans[i].end
+			}
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[start:end])))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:])))
+	return b.String()
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secret rotation overlap: how long previous secrets keep working after a
+// new one was issued
+const (
+	DefaultSecretRotationOverlap = 24 * time.Hour
+	MaxSecretRotationOverlap     = 7 * 24 * time.Hour
+)
+
+// ServiceAccountCacheTTL - How long AuthMiddleware trusts a cached service
+// account. Changes made through the service invalidate it right away.
+const ServiceAccountCacheTTL = 30 * time.Second
+
+// serviceAccountSecretPrefixLength - Characters kept in clear to recognize a secret
+const serviceAccountSecretPrefixLength = len(utils.ServiceAccountSecretPrefix) + 6
+
+var (
+	ErrServiceAccountNotFound     = errors.New("service account not found")
+	ErrServiceAccountNameRequired = errors.New("service account name is required")
+	ErrServiceAccountNameTaken    = errors.New("service account name already exists")
+	ErrServiceAccountDisabled     = errors.New("service account is disabled")
+	ErrServiceAccountOwner        = errors.New("owner must be a user allowed to manage service accounts")
+	ErrInvalidClientCredentials   = errors.New("invalid client credentials")
+	ErrSecretNotFound             = errors.New("secret not found")
+	ErrInvalidSecretOverlap       = fmt.Errorf("overlap must be between 0 and %s", MaxSecretRotationOverlap)
+	ErrInvalidScope               = errors.New("scope is not granted to the service account")
+	ErrRoleExceedsCaller          = errors.New("role grants permissions you do not have")
+)
+
+type cachedServiceAccount struct {
+	role     string
+	disabled bool
+	loadedAt time.Time
+}
+
+// serviceAccountCache - Service account ID -> role and state
+var serviceAccountCache = struct {
+	mu       sync.RWMutex
+	accounts map[uint]cachedServiceAccount
+}{accounts: make(map[uint]cachedServiceAccount)}
+
+// ServiceAccountService - Service accounts and their client credentials.
+// Permissions come from the account's role like for users.
+type ServiceAccountService struct {
+	permissions *PermissionService
+}
+
+func NewServiceAccountService() *ServiceAccountService {
+	return &ServiceAccountService{permissions: NewPermissionService()}
+}
+
+// ServiceAccountUpdate - Fields to change, nil fields are left as they are
+type ServiceAccountUpdate struct {
+	Description *string
+	RoleID      *uint
+	OwnerID     *uint
+	Disabled    *bool
+}
+
+// List - All service accounts with owner and role
+func (s *ServiceAccountService) List() ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	err := config.DB.Preload("Owner").Preload("Role").Order("name").Find(&accounts).Error
+	return accounts, err
+}
+
+// Get - One service account with owner, role and its usable secrets
+func (s *ServiceAccountService) Get(id uint) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := config.DB.Preload("Owner").Preload("Role").
+		Preload("Secrets", func(db *gorm.DB) *gorm.DB {
+			return db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now()).Order("created_at desc")
+		}).
+		First(&account, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Create - New service account owned by ownerID with its first secret. The
+// role may not grant more than callerRole. The raw secret is returned only here.
+func (s *ServiceAccountService) Create(name, description string, ownerID, roleID uint, callerRole string) (*models.ServiceAccount, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrServiceAccountNameRequired
+	}
+	var count int64
+	if err := config.DB.Model(&models.ServiceAccount{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count > 0 {
+		return nil, "", ErrServiceAccountNameTaken
+	}
+	if err := s.checkOwner(ownerID); err != nil {
+		return nil, "", err
+	}
+	if err := s.checkRole(callerRole, roleID); err != nil {
+		return nil, "", err
+	}
+
+	account := models.ServiceAccount{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		ClientID:    utils.GenerateClientID(),
+		OwnerID:     ownerID,
+		RoleID:      roleID,
+	}
+	var secret string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		var err error
+		secret, _, err = s.issueSecret(tx, account.ID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	created, err := s.Get(account.ID)
+	return created, secret, err
+}
+
+// checkOwner - Owners are users allowed to manage service accounts
+func (s *ServiceAccountService) checkOwner(ownerID uint) error {
+	var owner models.User
+	if err := config.DB.Preload("Role").First(&owner, ownerID).Error; err != nil {
+		return ErrServiceAccountOwner
+	}
+	allowed, err := s.permissions.HasPermission(owner.Role.Name, models.PermServiceAccountsWrite)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrServiceAccountOwner
+	}
+	return nil
+}
+
+// checkRole - The role exists and grants nothing callerRole lacks, otherwise
+// a service account could be used to mint tokens above the caller's own rights
+func (s *ServiceAccountService) checkRole(callerRole string, roleID uint) error {
+	allowed, err := s.permissions.CanAssign(callerRole, roleID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrRoleExceedsCaller
+	}
+	return nil
+}
+
+// Update - Change description, role, owner or disabled state. A new role may
+// not grant more than callerRole.
+func (s *ServiceAccountService) Update(id uint, update ServiceAccountUpdate, callerRole string) (*models.ServiceAccount, error) {
+	account, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	if update.Description != nil {
+		changes["description"] = strings.TrimSpace(*update.Description)
+	}
+	if update.RoleID != nil && *update.RoleID != account.RoleID {
+		if err := s.checkRole(callerRole, *update.RoleID); err != nil {
+			return nil, err
+		}
+		changes["role_id"] = *update.RoleID
+	}
+	if update.OwnerID != nil && *update.OwnerID != account.OwnerID {
+		if err := s.checkOwner(*update.OwnerID); err != nil {
+			return nil, err
+		}
+		changes["owner_id"] = *update.OwnerID
+	}
+	if update.Disabled != nil && *update.Disabled != (account.DisabledAt != nil) {
+		if *update.Disabled {
+			changes["disabled_at"] = time.Now()
+		} else {
+			// Accounts of a deleted owner stay disabled until reassigned
+			if _, reassigned := changes["owner_id"]; !reassigned {
+				if err := s.checkOwner(account.OwnerID); err != nil {
+					return nil, err
+				}
+			}
+			changes["disabled_at"] = nil
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := config.DB.Model(&models.ServiceAccount{}).Where("id = ?", id).Updates(changes).Error; err != nil {
+			return nil, err
+		}
+		s.Invalidate(id)
+	}
+	return s.Get(id)
+}
+
+// Delete - Remove a service account and its secrets, tokens issued to it stop
+// working right away
+func (s *ServiceAccountService) Delete(id uint) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_account_id = ?", id).Delete(&models.ServiceAccountSecret{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.ServiceAccount{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrServiceAccountNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Invalidate(id)
+	return nil
+}
+
+// disableForOwners - Disable the enabled service accounts of deleted owners
+// within the caller's transaction. Returns their IDs to Invalidate after the
+// commit.
+func (s *ServiceAccountService) disableForOwners(tx *gorm.DB, ownerIDs []uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Model(&models.ServiceAccount{}).
+		Where("owner_id IN ? AND disabled_at IS NULL", ownerIDs).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := tx.Model(&models.ServiceAccount{}).Where("id IN ?", ids).Update("disabled_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// deleteForOwners - Remove the service accounts of purged owners and their
+// secrets within the caller's transaction. Returns their IDs to Invalidate
+// after the commit.
+func (s *ServiceAccountService) deleteForOwners(tx *gorm.DB, ownerIDs []uint) ([]uint, error) {
+	var ids []uint
+	if err := tx.Model(&models.ServiceAccount{}).Where("owner_id IN ?", ownerIDs).Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := tx.Where("service_account_id IN ?", ids).Delete(&models.ServiceAccountSecret{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&models.ServiceAccount{}).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// RotateSecret - Issue a new secret. Previous secrets keep working for the
+// overlap window (0 ends them now). The raw secret is returned only here.
+func (s *ServiceAccountService) RotateSecret(id uint, overlap time.Duration) (string, *models.ServiceAccountSecret, error) {
+	if overlap < 0 || overlap > MaxSecretRotationOverlap {
+		return "", nil, ErrInvalidSecretOverlap
+	}
+	if err := config.DB.First(&models.ServiceAccount{}, id).Error; err != nil {
+		return "", nil, ErrServiceAccountNotFound
+	}
+
+	var raw string
+	var secret *models.ServiceAccountSecret
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var current []models.ServiceAccountSecret
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("service_account_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", id, now).
+			Find(&current).Error
+		if err != nil {
+			return err
+		}
+
+		for _, previous := range current {
+			expiresAt, shortened := rotatedSecretExpiry(previous.ExpiresAt, now, overlap)
+			if !shortened {
+				continue
+			}
+			if err := tx.Model(&previous).Update("expires_at", expiresAt).Error; err != nil {
+				return err
+			}
+		}
+
+		raw, secret, err = s.issueSecret(tx, id)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, secret, nil
+}
+
+// rotatedSecretExpiry - When a secret still in use ends after a rotation at
+// now. Only shortens, an earlier rotation may already end the secret sooner.
+func rotatedSecretExpiry(expiresAt *time.Time, now time.Time, overlap time.Duration) (time.Time, bool) {
+	end := now.Add(overlap)
+	if expiresAt != nil && !expiresAt.After(end) {
+		return *expiresAt, false
+	}
+	return end, true
+}
+
+func (s *ServiceAccountService) issueSecret(db *gorm.DB, serviceAccountID uint) (string, *models.ServiceAccountSecret, error) {
+	raw := utils.GenerateServiceAccountSecret()
+	secret := models.ServiceAccountSecret{
+		ServiceAccountID: serviceAccountID,
+		Prefix:           raw[:serviceAccountSecretPrefixLength],
+		SecretHash:       utils.HashToken(raw),
+	}
+	if err := db.Create(&secret).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, &secret, nil
+}
+
+// RevokeSecret - End one secret of a service account now
+func (s *ServiceAccountService) RevokeSecret(id, secretID uint) (*models.ServiceAccountSecret, error) {
+	var secret models.ServiceAccountSecret
+	if err := config.DB.Where("id = ? AND service_account_id = ? AND revoked_at IS NULL", secretID, id).First(&secret).Error; err != nil {
+		return nil, ErrSecretNotFound
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&secret).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	secret.RevokedAt = &now
+	return &secret, nil
+}
+
+// Authenticate - Service account (with role) for client credentials. Returns
+// the account together with ErrServiceAccountDisabled or
+// ErrInvalidClientCredentials when the client ID is known, for auditing.
+func (s *ServiceAccountService) Authenticate(clientID, clientSecret string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := config.DB.Preload("Role").Where("client_id = ?", clientID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClientCredentials
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	var secret models.ServiceAccountSecret
+	err := config.DB.
+		Where("service_account_id = ? AND secret_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)",
+			account.ID, utils.HashToken(clientSecret), now).
+		First(&secret).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &account, ErrInvalidClientCredentials
+		}
+		return nil, err
+	}
+	if account.DisabledAt != nil {
+		return &account, ErrServiceAccountDisabled
+	}
+
+	config.DB.Model(&secret).Update("last_used_at", now)
+	config.DB.Model(&account).Update("last_used_at", now)
+	return &account, nil
+}
+
+// IssueToken - Access token for an authenticated service account. scope is a
+// space separated subset of the role's permissions, empty for all of them.
+func (s *ServiceAccountService) IssueToken(account *models.ServiceAccount, scope string) (string, time.Time, string, error) {
+	granted, err := s.permissions.RolePermissions(account.Role.Name)
+	if err != nil {
+		return "", time.Time{}, "", err
+	}
+
+	scopes := strings.Fields(scope)
+	for _, requested := range scopes {
+		if !granted[requested] {
+			return "", time.Time{}, "", fmt.Errorf("%w: %s", ErrInvalidScope, requested)
+		}
+	}
+	scope = strings.Join(scopes, " ")
+
+	permissions := s.permissions.TokenPermissions(account.Role.Name)
+	if permissions != nil && len(scopes) > 0 {
+		permissions = scopes
+	}
+
+	token, expiresAt, err := utils.GenerateServiceAccountToken(account.ID, account.ClientID, account.Role.Name, scope, permissions)
+	return token, expiresAt, scope, err
+}
+
+// Role - Current role name of an enabled service account, for AuthMiddleware
+// (cached, see ServiceAccountCacheTTL)
+func (s *ServiceAccountService) Role(id uint) (string, error) {
+	serviceAccountCache.mu.RLock()
+	cached, ok := serviceAccountCache.accounts[id]
+	serviceAccountCache.mu.RUnlock()
+
+	if !ok || time.Since(cached.loadedAt) >= ServiceAccountCacheTTL {
+		var account models.ServiceAccount
+		if err := config.DB.Preload("Role").First(&account, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", ErrServiceAccountNotFound
+			}
+			return "", err
+		}
+
+		cached = cachedServiceAccount{role: account.Role.Name, disabled: account.DisabledAt != nil, loadedAt: time.Now()}
+		serviceAccountCache.mu.Lock()
+		serviceAccountCache.accounts[id] = cached
+		serviceAccountCache.mu.Unlock()
+	}
+
+	if cached.disabled {
+		return "", ErrServiceAccountDisabled
+	}
+	return cached.role, nil
+}
+
+// Invalidate - Drop the cached state of a service account
+func (s *ServiceAccountService) Invalidate(id uint) {
+	serviceAccountCache.mu.Lock()
+	delete(serviceAccountCache.accounts, id)
+	serviceAccountCache.mu.Unlock()
+}
+
+// InvalidateAll - Drop all cached service accounts, e.g. after role changes
+func (s *ServiceAccountService) InvalidateAll() {
+	serviceAccountCache.mu.Lock()
+	serviceAccountCache.accounts = make(map[uint]cachedServiceAccount)
+	serviceAccountCache.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+func TestIssueTokenScopes(t *testing.T) {
+	cachePermissions(t, map[string][]string{"reporter": {"reports:export", "reports:read"}})
+	account := &models.ServiceAccount{ID: 5, ClientID: "sa_test", Role: models.Role{Name: "reporter"}}
+
+	tests := []struct {
+		name            string
+		scope           string
+		embed           string
+		wantScope       string
+		wantPermissions []string
+		wantErr         error
+	}{
+		{name: "all permissions", scope: ""},
+		{name: "subset", scope: "reports:read", wantScope: "reports:read"},
+		{name: "extra whitespace", scope: "  reports:read   reports:export ", wantScope: "reports:read reports:export"},
+		{name: "not granted", scope: "reports:read users:write", wantErr: ErrInvalidScope},
+		{name: "embedded role permissions", embed: "true", wantPermissions: []string{"reports:export", "reports:read"}},
+		{name: "embedded scoped permissions", scope: "reports:read", embed: "true", wantScope: "reports:read", wantPermissions: []string{"reports:read"}},
+	}
+
+	service := NewServiceAccountService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_EMBED_PERMISSIONS", tt.embed)
+
+			token, expiresAt, scope, err := service.IssueToken(account, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if scope != tt.wantScope {
+				t.Errorf("got scope %q, want %q", scope, tt.wantScope)
+			}
+			if time.Until(expiresAt) > utils.ServiceAccountTokenLifetime {
+				t.Errorf("token expires at %s", expiresAt)
+			}
+
+			claims, err := utils.ValidateAccessToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.ServiceAccountID != account.ID || claims.ClientID != account.ClientID || claims.UserID != 0 {
+				t.Errorf("got claims %+v", claims)
+			}
+			if claims.Scope != tt.wantScope {
+				t.Errorf("got scope claim %q, want %q", claims.Scope, tt.wantScope)
+			}
+			if !reflect.DeepEqual(claims.Permissions, tt.wantPermissions) {
+				t.Errorf("got permissions %v, want %v", claims.Permissions, tt.wantPermissions)
+			}
+		})
+	}
+}
+
+func TestRotatedSecretExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.Add(time.Hour)
+	later := now.Add(48 * time.Hour)
+
+	tests := []struct {
+		name          string
+		expiresAt     *time.Time
+		overlap       time.Duration
+		want          time.Time
+		wantShortened bool
+	}{
+		{name: "current secret", overlap: 24 * time.Hour, want: now.Add(24 * time.Hour), wantShortened: true},
+		{name: "no overlap", overlap: 0, want: now, wantShortened: true},
+		{name: "earlier rotation ends later", expiresAt: &later, overlap: 24 * time.Hour, want: now.Add(24 * time.Hour), wantShortened: true},
+		{name: "earlier rotation ends sooner", expiresAt: &soon, overlap: 24 * time.Hour, want: soon},
+		{name: "same end", expiresAt: &soon, overlap: time.Hour, want: soon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, shortened := rotatedSecretExpiry(tt.expiresAt, now, tt.overlap)
+			if !got.Equal(tt.want) || shortened != tt.wantShortened {
+				t.Errorf("got %s %v, want %s %v", got, shortened, tt.want, tt.wantShortened)
+			}
+		})
+	}
+}
+
+// The overlap is checked before any database access
+func TestRotateSecretOverlapBounds(t *testing.T) {
+	service := NewServiceAccountService()
+	for _, overlap := range []time.Duration{-time.Second, MaxSecretRotationOverlap + time.Second} {
+		if _, _, err := service.RotateSecret(1, overlap); !errors.Is(err, ErrInvalidSecretOverlap) {
+			t.Errorf("overlap %s: got error %v, want %v", overlap, err, ErrInvalidSecretOverlap)
+		}
+	}
+}
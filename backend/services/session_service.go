@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval - LastSeenAt is written at most once per interval
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+var sessionTouches = newTouchThrottle(sessionTouchInterval)
+
+// touchThrottle - When an ID was last written, so that frequent requests write
+// at most once per interval. Entries older than the interval no longer hold
+// anything back and are swept out, at most once per interval.
+type touchThrottle struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	last      map[uint]time.Time
+	lastSweep time.Time
+}
+
+func newTouchThrottle(interval time.Duration) *touchThrottle {
+	return &touchThrottle{interval: interval, last: make(map[uint]time.Time)}
+}
+
+// allow - Whether id may be written at now, which is then remembered
+func (t *touchThrottle) allow(id uint, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= t.interval {
+		for key, last := range t.last {
+			if now.Sub(last) >= t.interval {
+				delete(t.last, key)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	if last, ok := t.last[id]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.last[id] = now
+	return true
+}
+
+type SessionService struct{}
+
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
+
+// Create - Start a new session and return it with the first refresh token of its family
+func (s *SessionService) Create(userID uint, userAgent, ipAddress string) (*models.Session, string, error) {
+	var session models.Session
+	var refreshToken string
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session = models.Session{
+			UserID:     userID,
+			FamilyID:   utils.NewTokenID(),
+			UserAgent:  userAgent,
+			IPAddress:  ipAddress,
+			LastSeenAt: now,
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		refreshToken, _, err = NewRefreshTokenService().issue(tx, userID, session.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, refreshToken, nil
+}
+
+// GetByFamily - Find the session owning a refresh token family
+func (s *SessionService) GetByFamily(familyID string) (*models.Session, error) {
+	var session models.Session
+	if err := config.DB.Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch - Update LastSeenAt, throttled to avoid a write on every request
+func (s *SessionService) Touch(sessionID uint) {
+	if sessionID == 0 {
+		return
+	}
+
+	now := time.Now()
+	if !sessionTouches.allow(sessionID, now) {
+		return
+	}
+
+	if err := config.DB.Model(&models.Session{}).Where("id = ?", sessionID).Update("last_seen_at", now).Error; err != nil {
+		log.Printf("Failed to update session %d last seen: %v", sessionID, err)
+	}
+}
+
+// ListActive - Sessions of a user that are not revoked and can still refresh
+func (s *SessionService) ListActive(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := config.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, time.Now().Add(-RefreshTokenLifetime)).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke - Revoke one session of a user together with its tokens
+func (s *SessionService) Revoke(userID, sessionID uint) error {
+	var session models.Session
+	if err := config.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return ErrSessionNotFound
+	}
+	return s.revoke(&session)
+}
+
+// RevokeFamily - Revoke the session owning a refresh token family
+func (s *SessionService) RevokeFamily(familyID string) error {
+	session, err := s.GetByFamily(familyID)
+	if err != nil {
+		// Family without session, just kill the refresh tokens
+		return NewRefreshTokenService().RevokeFamily(familyID)
+	}
+	return s.revoke(session)
+}
+
+// RevokeOthers - Revoke all sessions of a user except the current one
+func (s *SessionService) RevokeOthers(userID, currentSessionID uint) (int, error) {
+	var sessions []models.Session
+	if err := config.DB.Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range sessions {
+		if err := s.revoke(&sessions[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func (s *SessionService) revoke(session *models.Session) error {
+	if err := NewRefreshTokenService().RevokeFamily(session.FamilyID); err != nil {
+		return err
+	}
+
+	if session.RevokedAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(session).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+	}
+
+	return NewRevocationService().RevokeSession(session.UserID, session.ID)
+}
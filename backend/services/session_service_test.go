@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTouchThrottle(t *testing.T) {
+	start := time.Date(2026, 7, 1, 9, 0, 0, 0, time.UTC)
+	throttle := newTouchThrottle(time.Minute)
+
+	steps := []struct {
+		name    string
+		id      uint
+		at      time.Duration
+		want    bool
+		wantLen int
+	}{
+		{name: "first touch", id: 1, at: 0, want: true, wantLen: 1},
+		{name: "within the interval", id: 1, at: 30 * time.Second, want: false, wantLen: 1},
+		{name: "other id", id: 2, at: 40 * time.Second, want: true, wantLen: 2},
+		// The sweep drops id 1, id 2 is still within its interval
+		{name: "after the interval", id: 3, at: 70 * time.Second, want: true, wantLen: 2},
+		{name: "swept id", id: 1, at: 80 * time.Second, want: true, wantLen: 3},
+		{name: "later sweep", id: 3, at: 3 * time.Minute, want: true, wantLen: 1},
+	}
+
+	for _, step := range steps {
+		if got := throttle.allow(step.id, start.Add(step.at)); got != step.want {
+			t.Errorf("%s: got %v, want %v", step.name, got, step.want)
+		}
+		if got := len(throttle.last); got != step.wantLen {
+			t.Errorf("%s: %d entries kept, want %d", step.name, got, step.wantLen)
+		}
+	}
+}
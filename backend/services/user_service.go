@@ -1,10 +1,54 @@
 package services
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
 	"backend/config"
 	"backend/models"
+
+	"gorm.io/gorm"
+)
+
+// User list limits
+const (
+	DefaultUserListLimit = 20
+	MaxUserListLimit     = 100
+)
+
+// User list filters by email verification, any account status is accepted too
+const (
+	UserStatusVerified   = "verified"
+	UserStatusUnverified = "unverified"
 )
 
+// DefaultUserRetentionDays - Deleted users are purged after 30 days
+const DefaultUserRetentionDays = 30
+
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrUserNotDeleted = errors.New("user is not deleted")
+	ErrInvalidCursor  = errors.New("invalid or expired cursor")
+	ErrInvalidSort    = errors.New("invalid sort field")
+	ErrInvalidStatus  = errors.New("invalid status filter")
+)
+
+// userSortColumns - Fields the user list can be sorted by
+var userSortColumns = map[string]string{
+	"id":         "users.id",
+	"name":       "users.name",
+	"email":      "users.email",
+	"created_at": "users.created_at",
+	"updated_at": "users.updated_at",
+}
+
 type UserService struct{}
 
 func NewUserService() *UserService {
@@ -32,3 +76,534 @@ func (s *UserService) GetAllUsers(page, limit int) ([]models.User, int64, error)
 
 	return users, total, err
 }
+
+// UserSort - One sort key of the user list
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseUserSort - Parse "-created_at,name" into sort keys, "-" means descending
+func ParseUserSort(spec string) ([]UserSort, error) {
+	var sorts []UserSort
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sort := UserSort{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := userSortColumns[sort.Field]; !ok || seen[sort.Field] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sort.Field)
+		}
+		seen[sort.Field] = true
+		sorts = append(sorts, sort)
+	}
+	return sorts, nil
+}
+
+// UserListQuery - Filters, sorting and pagination of the admin user list.
+// Cursor takes precedence over Page.
+type UserListQuery struct {
+	Page        int
+	Limit       int
+	Cursor      string
+	Role        string // role name or ID
+	Status      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time // exclusive
+	Search      string
+	Sort        []UserSort
+}
+
+// UserListResult - One page of users
+type UserListResult struct {
+	Users      []models.User
+	Total      int64 // matching users across all pages
+	NextCursor string
+	HasMore    bool
+}
+
+// userCursor - Position after the last user of a page
+type userCursor struct {
+	Sort   string            `json:"s"` // sort spec the cursor was issued for
+	Values map[string]string `json:"v"`
+}
+
+// ListUsers - Filtered, sorted and paginated users with their role
+func (s *UserService) ListUsers(q UserListQuery) (*UserListResult, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultUserListLimit
+	}
+	if q.Limit > MaxUserListLimit {
+		q.Limit = MaxUserListLimit
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+
+	filtered, err := s.filterUsers(config.DB.Model(&models.User{}), q)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	// id is always the last key so that the order is total and cursors are stable
+	sorts := withIDTiebreak(q.Sort)
+	query := filtered.Session(&gorm.Session{}).Preload("Role")
+	for _, sort := range sorts {
+		direction := "ASC"
+		if sort.Desc {
+			direction = "DESC"
+		}
+		query = query.Order(userSortColumns[sort.Field] + " " + direction)
+	}
+
+	if q.Cursor != "" {
+		condition, args, err := cursorCondition(q.Cursor, sorts)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(condition, args...)
+	} else {
+		query = query.Offset((q.Page - 1) * q.Limit)
+	}
+
+	var users []models.User
+	if err := query.Limit(q.Limit + 1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	result := &UserListResult{Total: total}
+	if len(users) > q.Limit {
+		users = users[:q.Limit]
+		result.HasMore = true
+		result.NextCursor = encodeUserCursor(users[len(users)-1], sorts)
+	}
+	result.Users = users
+	return result, nil
+}
+
+// filterUsers - Apply role, status, date and search filters
+func (s *UserService) filterUsers(db *gorm.DB, q UserListQuery) (*gorm.DB, error) {
+	if q.Role != "" {
+		if roleID, err := strconv.Atoi(q.Role); err == nil {
+			db = db.Where("users.role_id = ?", roleID)
+		} else {
+			db = db.Where("users.role_id IN (?)", config.DB.Model(&models.Role{}).Select("id").Where("name = ?", q.Role))
+		}
+	}
+
+	switch q.Status {
+	case "":
+	case UserStatusVerified:
+		db = db.Where("users.email_verified_at IS NOT NULL")
+	case UserStatusUnverified:
+		db = db.Where("users.email_verified_at IS NULL")
+	default:
+		if !IsAccountStatus(q.Status) {
+			return nil, ErrInvalidStatus
+		}
+		db = db.Where("users.status = ?", q.Status)
+	}
+
+	if q.CreatedFrom != nil {
+		db = db.Where("users.created_at >= ?", *q.CreatedFrom)
+	}
+	if q.CreatedTo != nil {
+		db = db.Where("users.created_at < ?", *q.CreatedTo)
+	}
+
+	if search := strings.TrimSpace(q.Search); search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		db = db.Where("(users.name ILIKE ? OR users.email ILIKE ?)", pattern, pattern)
+	}
+	return db, nil
+}
+
+func withIDTiebreak(sorts []UserSort) []UserSort {
+	for _, sort := range sorts {
+		if sort.Field == "id" {
+			return sorts
+		}
+	}
+	return append(append([]UserSort{}, sorts...), UserSort{Field: "id"})
+}
+
+func sortSpec(sorts []UserSort) string {
+	parts := make([]string, len(sorts))
+	for i, sort := range sorts {
+		parts[i] = sort.Field
+		if sort.Desc {
+			parts[i] = "-" + sort.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func encodeUserCursor(user models.User, sorts []UserSort) string {
+	values := make(map[string]string, len(sorts))
+	for _, sort := range sorts {
+		switch sort.Field {
+		case "id":
+			values["id"] = strconv.FormatUint(uint64(user.ID), 10)
+		case "name":
+			values["name"] = user.Name
+		case "email":
+			values["email"] = user.Email
+		case "created_at":
+			values["created_at"] = user.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			values["updated_at"] = user.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	}
+
+	data, _ := json.Marshal(userCursor{Sort: sortSpec(sorts), Values: values})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorCondition - Keyset condition selecting rows after the cursor:
+// (a > x) OR (a = x AND b > y) OR ..., with < for descending keys
+func cursorCondition(raw string, sorts []UserSort) (string, []interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sortSpec(sorts) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(sorts))
+	for i, sort := range sorts {
+		value, ok := cursor.Values[sort.Field]
+		if !ok {
+			return "", nil, ErrInvalidCursor
+		}
+		switch sort.Field {
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return "", nil, ErrInvalidCursor
+			}
+			values[i] = id
+		case "created_at", "updated_at":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return "", nil, ErrInvalidCursor
+			}
+			values[i] = t
+		default:
+			values[i] = value
+		}
+	}
+
+	var clauses []string
+	var args []interface{}
+	for i, sort := range sorts {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, userSortColumns[sorts[j].Field]+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if sort.Desc {
+			op = " < ?"
+		}
+		parts = append(parts, userSortColumns[sort.Field]+op)
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args, nil
+}
+
+// escapeLike - Escape LIKE wildcards so search terms match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// UserRetentionDays - Days a soft-deleted user is kept before it is purged
+// (USER_RETENTION_DAYS, 0 keeps deleted users forever)
+func UserRetentionDays() int {
+	if value := os.Getenv("USER_RETENTION_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			return days
+		}
+		log.Printf("Invalid USER_RETENTION_DAYS %q, using %d", value, DefaultUserRetentionDays)
+	}
+	return DefaultUserRetentionDays
+}
+
+// DeletedUser - Soft-deleted user with the time it will be purged
+type DeletedUser struct {
+	models.User
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at"` // nil when retention is disabled
+}
+
+// ListDeletedUsers - Soft-deleted users, most recently deleted first
+func (s *UserService) ListDeletedUsers(page, limit int) ([]DeletedUser, int64, error) {
+	var users []models.User
+	var total int64
+
+	deleted := config.DB.Unscoped().Model(&models.User{}).Where("deleted_at IS NOT NULL")
+	if err := deleted.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := deleted.Session(&gorm.Session{}).Preload("Role").
+		Order("deleted_at DESC, id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	retention := UserRetentionDays()
+	result := make([]DeletedUser, len(users))
+	for i, user := range users {
+		result[i] = DeletedUser{User: user, DeletedAt: user.DeletedAt.Time}
+		if retention > 0 {
+			purgeAt := user.DeletedAt.Time.AddDate(0, 0, retention)
+			result[i].PurgeAt = &purgeAt
+		}
+	}
+	return result, total, nil
+}
+
+// UpdateProfile - Apply profile updates of the user. A new password also
+// revokes every session and token except the session keepSessionID, in the
+// same transaction, and ends outstanding password reset links.
+func (s *UserService) UpdateProfile(user *models.User, updates map[string]interface{}, keepSessionID uint) error {
+	_, passwordChanged := updates["password"]
+	revocationService := NewRevocationService()
+
+	var revoked *models.RevokedToken
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(user).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if !passwordChanged {
+			return nil
+		}
+
+		if err := NewPasswordResetService().invalidate(tx, user.ID); err != nil {
+			return err
+		}
+
+		var err error
+		revoked, err = revocationService.RevokeAllForUserTx(tx, user.ID, keepSessionID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if revoked != nil {
+		revocationService.Remember(revoked)
+	}
+	return nil
+}
+
+// UpdateUser - Apply an admin's updates to a user and reload it. A new
+// password or role revokes every session and token of the user, and a new
+// password ends outstanding reset links. record writes the audit event in the
+// same transaction.
+func (s *UserService) UpdateUser(user *models.User, updates map[string]interface{}, record func(tx *gorm.DB) error) error {
+	_, passwordChanged := updates["password"]
+	_, roleChanged := updates["role_id"]
+	revocationService := NewRevocationService()
+
+	var revoked *models.RevokedToken
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(user).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.First(user, user.ID).Error; err != nil {
+			return err
+		}
+
+		if passwordChanged {
+			if err := NewPasswordResetService().invalidate(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		if passwordChanged || roleChanged {
+			var err error
+			if revoked, err = revocationService.RevokeAllForUserTx(tx, user.ID, 0); err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	if revoked != nil {
+		revocationService.Remember(revoked)
+	}
+	if roleChanged {
+		NewAccountStatusService().Invalidate(user.ID)
+	}
+	return nil
+}
+
+// DeleteUser - Soft-delete a user, sign them out everywhere and disable the
+// service accounts they own. Restoring the user does not enable them again.
+func (s *UserService) DeleteUser(id uint) error {
+	revocationService := NewRevocationService()
+	serviceAccountService := NewServiceAccountService()
+
+	var revoked *models.RevokedToken
+	var disabled []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.User{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		var err error
+		if disabled, err = serviceAccountService.disableForOwners(tx, []uint{id}); err != nil {
+			return err
+		}
+		revoked, err = revocationService.RevokeAllForUserTx(tx, id, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	revocationService.Remember(revoked)
+	for _, accountID := range disabled {
+		serviceAccountService.Invalidate(accountID)
+	}
+	return nil
+}
+
+// RestoreUser - Undo a soft delete. Fails when another account has taken the
+// email in the meantime.
+func (s *UserService) RestoreUser(id uint) (*models.User, error) {
+	var user models.User
+	if err := config.DB.Unscoped().First(&user, id).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.DeletedAt.Valid {
+		return nil, ErrUserNotDeleted
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("lower(email) = lower(?)", user.Email).Count(&count)
+	if count > 0 {
+		return nil, ErrEmailAlreadyRegistered
+	}
+
+	if err := config.DB.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(user.ID)
+}
+
+// PurgeUser - Permanently delete a soft-deleted user and their credentials,
+// sessions and tokens
+func (s *UserService) PurgeUser(id uint) error {
+	var user models.User
+	if err := config.DB.Unscoped().First(&user, id).Error; err != nil {
+		return ErrUserNotFound
+	}
+	if !user.DeletedAt.Valid {
+		return ErrUserNotDeleted
+	}
+	return purgeUsers([]uint{user.ID})
+}
+
+// PurgeDeletedUsers - Purge users deleted before the retention period
+func (s *UserService) PurgeDeletedUsers() (int, error) {
+	retention := UserRetentionDays()
+	if retention == 0 {
+		return 0, nil
+	}
+
+	var ids []uint
+	err := config.DB.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().AddDate(0, 0, -retention)).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return len(ids), purgeUsers(ids)
+}
+
+// StartRetentionPurge - Purge expired deleted users periodically
+func (s *UserService) StartRetentionPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			count, err := s.PurgeDeletedUsers()
+			if err != nil {
+				log.Printf("Failed to purge deleted users: %v", err)
+			} else if count > 0 {
+				log.Printf("Purged %d deleted users", count)
+			}
+		}
+	}()
+}
+
+// purgeUsers - Hard delete users together with the rows that reference them
+// and the service accounts they own. Revocation entries are kept until they
+// expire.
+func purgeUsers(ids []uint) error {
+	serviceAccountService := NewServiceAccountService()
+
+	var deleted []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if deleted, err = serviceAccountService.deleteForOwners(tx, ids); err != nil {
+			return err
+		}
+
+		dependents := []interface{}{
+			&models.RefreshToken{},
+			&models.Session{},
+			&models.MFARecoveryCode{},
+			&models.WebAuthnCredential{},
+			&models.PasswordReset{},
+			&models.PersonalAccessToken{},
+			&models.UserStatusChange{},
+			&models.WebAuthnCeremony{},
+		}
+		for _, model := range dependents {
+			if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("invited_by IN ?", ids).Delete(&models.Invitation{}).Error; err != nil {
+			return err
+		}
+		// Status changes the users made to other accounts stay in their history
+		if err := tx.Model(&models.UserStatusChange{}).Where("changed_by IN ?", ids).Update("changed_by", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ? AND deleted_at IS NOT NULL", ids).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, accountID := range deleted {
+		serviceAccountService.Invalidate(accountID)
+	}
+	return nil
+}
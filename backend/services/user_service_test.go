@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestParseUserSort(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []UserSort
+		wantErr error
+	}{
+		{spec: "", want: nil},
+		{spec: "name", want: []UserSort{{Field: "name"}}},
+		{spec: "-created_at", want: []UserSort{{Field: "created_at", Desc: true}}},
+		{
+			spec: " -created_at , name,,id ",
+			want: []UserSort{{Field: "created_at", Desc: true}, {Field: "name"}, {Field: "id"}},
+		},
+		{spec: "password", wantErr: ErrInvalidSort},
+		{spec: "users.name", wantErr: ErrInvalidSort},
+		{spec: "name,-name", wantErr: ErrInvalidSort},
+		{spec: "--name", wantErr: ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseUserSort(tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithIDTiebreak(t *testing.T) {
+	tests := []struct {
+		name  string
+		sorts []UserSort
+		want  []UserSort
+	}{
+		{name: "no sort", sorts: nil, want: []UserSort{{Field: "id"}}},
+		{name: "appended", sorts: []UserSort{{Field: "name"}}, want: []UserSort{{Field: "name"}, {Field: "id"}}},
+		{name: "already sorted by id", sorts: []UserSort{{Field: "id", Desc: true}}, want: []UserSort{{Field: "id", Desc: true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withIDTiebreak(tt.sorts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorCondition(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	user := models.User{ID: 42, Name: "Jane", Email: "jane@example.com", CreatedAt: created}
+
+	tests := []struct {
+		name      string
+		sorts     []UserSort
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "id only",
+			sorts:     []UserSort{{Field: "id"}},
+			wantWhere: "((users.id > ?))",
+			wantArgs:  []interface{}{uint64(42)},
+		},
+		{
+			name:      "descending with tiebreak",
+			sorts:     []UserSort{{Field: "created_at", Desc: true}, {Field: "id"}},
+			wantWhere: "((users.created_at < ?) OR (users.created_at = ? AND users.id > ?))",
+			wantArgs:  []interface{}{created, created, uint64(42)},
+		},
+		{
+			name:  "three keys",
+			sorts: []UserSort{{Field: "name"}, {Field: "email", Desc: true}, {Field: "id"}},
+			wantWhere: "((users.name > ?) OR (users.name = ? AND users.email < ?) OR " +
+				"(users.name = ? AND users.email = ? AND users.id > ?))",
+			wantArgs: []interface{}{"Jane", "Jane", "jane@example.com", "Jane", "jane@example.com", uint64(42)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := cursorCondition(encodeUserCursor(user, tt.sorts), tt.sorts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if where != tt.wantWhere {
+				t.Errorf("got condition %s, want %s", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCursorConditionRejects(t *testing.T) {
+	sorts := []UserSort{{Field: "created_at", Desc: true}, {Field: "id"}}
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not json", cursor: encode("cursor")},
+		{
+			name:   "issued for another sort",
+			cursor: encodeUserCursor(models.User{ID: 1}, []UserSort{{Field: "name"}, {Field: "id"}}),
+		},
+		{
+			name:   "issued for another direction",
+			cursor: encodeUserCursor(models.User{ID: 1}, []UserSort{{Field: "created_at"}, {Field: "id"}}),
+		},
+		{name: "missing value", cursor: encode(`{"s":"-created_at,id","v":{"id":"1"}}`)},
+		{name: "invalid id", cursor: encode(`{"s":"-created_at,id","v":{"created_at":"2026-03-01T12:30:00Z","id":"x"}}`)},
+		{name: "invalid time", cursor: encode(`{"s":"-created_at,id","v":{"created_at":"yesterday","id":"1"}}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := cursorCondition(tt.cursor, sorts); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
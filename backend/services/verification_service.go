@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"backend/utils"
+)
+
+// Email verification policies (EMAIL_VERIFICATION_POLICY)
+const (
+	// VerificationOptional - Verification is offered but not enforced
+	VerificationOptional = "optional"
+	// VerificationBlockLogin - Unverified users cannot log in
+	VerificationBlockLogin = "block_login"
+	// VerificationRestrict - Unverified users can log in but restricted routes return 403
+	VerificationRestrict = "restrict"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// EmailVerificationPolicy - Current policy, optional when unset or unknown
+func EmailVerificationPolicy() string {
+	switch policy := os.Getenv("EMAIL_VERIFICATION_POLICY"); policy {
+	case VerificationBlockLogin, VerificationRestrict:
+		return policy
+	default:
+		return VerificationOptional
+	}
+}
+
+// AppURL - Base URL of the frontend used in links sent to users
+func AppURL() string {
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		return appURL
+	}
+	return "http://localhost:3000"
+}
+
+type VerificationService struct{}
+
+func NewVerificationService() *VerificationService {
+	return &VerificationService{}
+}
+
+// SendVerification - Issue a verification token and deliver the link to the user
+func (s *VerificationService) SendVerification(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := utils.GenerateEmailVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := AppURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return mailer.Default().SendVerification(user.Email, user.Name, link)
+}
+
+// Verify - Consume a verification token and mark the email as verified
+func (s *VerificationService) Verify(token string) (*models.User, error) {
+	claims, err := utils.ValidateEmailVerificationToken(token)
+	if err != nil || NewRevocationService().IsRevoked(claims) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, claims.UserID).Error; err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// Token is bound to the address it was sent to
+	if user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil, ErrEmailAlreadyVerified
+	}
+
+	now := time.Now()
+	result := config.DB.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", user.ID).
+		Update("email_verified_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrEmailAlreadyVerified
+	}
+
+	// Single use
+	if err := NewRevocationService().RevokeToken(claims); err != nil {
+		log.Printf("Failed to revoke verification token: %v", err)
+	}
+
+	user.EmailVerifiedAt = &now
+	return &user, nil
+}
+
+// IsVerified - Whether the user's email is verified
+func (s *VerificationService) IsVerified(userID uint) bool {
+	var user models.User
+	if err := config.DB.Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.EmailVerifiedAt != nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+	"backend/webauthn"
+)
+
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+	CeremonyMFA          = "mfa"
+)
+
+var (
+	ErrCeremonyNotFound   = errors.New("passkey ceremony not found or expired")
+	ErrCredentialNotFound = errors.New("passkey not found")
+)
+
+var relyingParty = struct {
+	once sync.Once
+	rp   *webauthn.WebAuthn
+}{}
+
+type WebAuthnService struct{}
+
+func NewWebAuthnService() *WebAuthnService {
+	return &WebAuthnService{}
+}
+
+func (s *WebAuthnService) rp() *webauthn.WebAuthn {
+	relyingParty.once.Do(func() {
+		relyingParty.rp = webauthn.New(webauthn.ConfigFromEnv())
+	})
+	return relyingParty.rp
+}
+
+// userHandle - Opaque WebAuthn user handle for a user ID
+func userHandle(userID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(userID), 10))
+}
+
+func encodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// store - Persist the ceremony state and return the ID handed to the client
+func (s *WebAuthnService) store(purpose string, userID uint, session *webauthn.SessionData) (string, error) {
+	id := utils.GenerateOpaqueToken()
+
+	allowed := make([]string, 0, len(session.AllowedCredentials))
+	for _, credentialID := range session.AllowedCredentials {
+		allowed = append(allowed, encodeCredentialID(credentialID))
+	}
+
+	err := config.DB.Create(&models.WebAuthnCeremony{
+		TokenHash:          utils.HashToken(id),
+		Purpose:            purpose,
+		UserID:             userID,
+		Challenge:          session.Challenge,
+		AllowedCredentials: strings.Join(allowed, ","),
+		UserVerification:   session.UserVerification,
+		ExpiresAt:          session.Expires,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// take - Delete and return a ceremony so each challenge is answered only once,
+// even when the same response is sent twice concurrently
+func (s *WebAuthnService) take(id, purpose string) (*models.WebAuthnCeremony, *webauthn.SessionData, error) {
+	var record models.WebAuthnCeremony
+	result := config.DB.Raw(`
+		DELETE FROM web_authn_ceremonies
+		WHERE token_hash = ? AND purpose = ? AND expires_at > ?
+		RETURNING *`, utils.HashToken(id), purpose, time.Now()).Scan(&record)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrCeremonyNotFound
+	}
+
+	session := &webauthn.SessionData{
+		Challenge:        record.Challenge,
+		UserVerification: record.UserVerification,
+		Expires:          record.ExpiresAt,
+	}
+	if purpose == CeremonyRegistration {
+		session.UserID = userHandle(record.UserID)
+	}
+	for _, encoded := range strings.Split(record.AllowedCredentials, ",") {
+		if credentialID, err := base64.RawURLEncoding.DecodeString(encoded); err == nil && len(credentialID) > 0 {
+			session.AllowedCredentials = append(session.AllowedCredentials, credentialID)
+		}
+	}
+	return &record, session, nil
+}
+
+// PurgeExpired - Delete ceremonies that were never answered
+func (s *WebAuthnService) PurgeExpired() (int64, error) {
+	result := config.DB.Where("expires_at <= ?", time.Now()).Delete(&models.WebAuthnCeremony{})
+	return result.RowsAffected, result.Error
+}
+
+// StartCleanup - Periodically purge expired ceremonies
+func (s *WebAuthnService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge passkey ceremonies: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *WebAuthnService) credentialIDs(userID uint) ([][]byte, error) {
+	credentials, err := s.ListCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(credential.CredentialID)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// BeginRegistration - Creation options for a new passkey of the user
+func (s *WebAuthnService) BeginRegistration(user *models.User) (string, *webauthn.CredentialCreationOptions, error) {
+	exclude, err := s.credentialIDs(user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	options, session := s.rp().BeginRegistration(webauthn.User{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, exclude)
+
+	id, err := s.store(CeremonyRegistration, user.ID, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, options, nil
+}
+
+// FinishRegistration - Verify attestation and store the new passkey
+func (s *WebAuthnService) FinishRegistration(userID uint, ceremonyID, name string, resp *webauthn.RegistrationResponse) (*models.WebAuthnCredential, error) {
+	c, session, err := s.take(ceremonyID, CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserID != userID {
+		return nil, ErrCeremonyNotFound
+	}
+
+	credential, err := s.rp().FinishRegistration(session, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+	record := models.WebAuthnCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: encodeCredentialID(credential.ID),
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		AAGUID:       encodeCredentialID(credential.AAGUID),
+		Transports:   strings.Join(credential.Transports, ","),
+	}
+	if err := config.DB.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BeginLogin - Request options. userID 0 starts a discoverable (usernameless) login.
+func (s *WebAuthnService) BeginLogin(userID uint, purpose string) (string, *webauthn.CredentialRequestOptions, error) {
+	var allowed [][]byte
+	if userID != 0 {
+		var err error
+		if allowed, err = s.credentialIDs(userID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	options, session := s.rp().BeginLogin(allowed)
+	id, err := s.store(purpose, userID, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, options, nil
+}
+
+// FinishLogin - Verify an assertion and return the owner of the passkey and
+// whether the authenticator verified the user (PIN or biometric)
+func (s *WebAuthnService) FinishLogin(ceremonyID, purpose string, resp *webauthn.AssertionResponse) (uint, bool, error) {
+	c, session, err := s.take(ceremonyID, purpose)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var record models.WebAuthnCredential
+	if err := config.DB.Where("credential_id = ?", encodeCredentialID(resp.RawID)).First(&record).Error; err != nil {
+		return 0, false, ErrCredentialNotFound
+	}
+
+	// Passkey must belong to the user the ceremony was started for, and to
+	// the user handle the authenticator returned
+	if c.UserID != 0 && record.UserID != c.UserID {
+		return 0, false, ErrCredentialNotFound
+	}
+	if len(resp.Response.UserHandle) > 0 && !bytes.Equal(resp.Response.UserHandle, userHandle(record.UserID)) {
+		return 0, false, ErrCredentialNotFound
+	}
+
+	credentialID, _ := base64.RawURLEncoding.DecodeString(record.CredentialID)
+	assertion, err := s.rp().FinishLogin(session, resp, &webauthn.Credential{
+		ID:        credentialID,
+		PublicKey: record.PublicKey,
+		SignCount: record.SignCount,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&record).Updates(map[string]interface{}{
+		"sign_count":   assertion.SignCount,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return 0, false, err
+	}
+
+	return record.UserID, assertion.UserVerified, nil
+}
+
+// HasCredentials - Whether the user registered at least one passkey
+func (s *WebAuthnService) HasCredentials(userID uint) bool {
+	var count int64
+	config.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count)
+	return count > 0
+}
+
+// ListCredentials - Passkeys of a user
+func (s *WebAuthnService) ListCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+// DeleteCredential - Remove one passkey of a user
+func (s *WebAuthnService) DeleteCredential(userID, id uint) error {
+	result := config.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
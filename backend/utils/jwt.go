@@ -1,86 +1,186 @@
 package utils
 
 import (
-	"os"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
+var (
+	keyring     *Keyring
+	keyringOnce sync.Once
+)
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-default-secret-key" // Change this in production
-	}
-	jwtSecret = []byte(secret)
+// Keys - Keyring used to sign and verify tokens, loaded from env on first use
+func Keys() *Keyring {
+	keyringOnce.Do(func() {
+		k, err := LoadKeyringFromEnv()
+		if err != nil {
+			log.Fatal("Failed to load JWT signing keys:", err)
+		}
+		keyring = k
+	})
+	return keyring
 }
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid,omitempty"`
+	// Permissions - Role permissions at issue time, only set when
+	// JWT_EMBED_PERMISSIONS is enabled
+	Permissions []string `json:"perms,omitempty"`
+	// Act - Set when someone else acts as UserID (RFC 8693 actor claim)
+	Act *Actor `json:"act,omitempty"`
+	// Service account tokens (client credentials) have no user, ClientID and
+	// Scope follow RFC 9068
+	ServiceAccountID uint   `json:"service_account_id,omitempty"`
+	ClientID         string `json:"client_id,omitempty"`
+	Scope            string `json:"scope,omitempty"` // space separated, empty means all role permissions
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT - Generate access token with 24 hour expiry
-func GenerateJWT(userID uint, email, role string) (string, error) {
+// Actor - The party actually holding an impersonation token
+type Actor struct {
+	Subject string `json:"sub"` // actor user ID
+	Email   string `json:"email"`
+}
+
+// ImpersonationTokenLifetime - Impersonation tokens are short-lived and cannot be refreshed
+const ImpersonationTokenLifetime = 15 * time.Minute
+
+// ServiceAccountTokenLifetime - Client credentials tokens, requested again when expired
+const ServiceAccountTokenLifetime = time.Hour
+
+// NewTokenID - Generate random unique identifier for the jti claim
+func NewTokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// GenerateJWT - Generate access token with 24 hour expiry, issued at issuedAt
+// (see RevocationService.IssuedAt)
+func GenerateJWT(userID uint, email, role string, sessionID uint, permissions []string, issuedAt time.Time) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:      userID,
+		Email:       email,
+		Role:        role,
+		SessionID:   sessionID,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(24 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ID:        NewTokenID(),
+			Subject:   "access",
+		},
+	}
+
+	return Keys().Sign(claims)
+}
+
+// GenerateImpersonationToken - Access token for userID held by actor, with
+// the act claim and no session or refresh token
+func GenerateImpersonationToken(userID uint, email, role string, permissions []string, actorID uint, actorEmail string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ImpersonationTokenLifetime)
+	claims := Claims{
+		UserID:      userID,
+		Email:       email,
+		Role:        role,
+		Permissions: permissions,
+		Act: &Actor{
+			Subject: strconv.FormatUint(uint64(actorID), 10),
+			Email:   actorEmail,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        NewTokenID(),
+			Subject:   "access",
+		},
+	}
+
+	token, err := Keys().Sign(claims)
+	return token, expiresAt, err
+}
+
+// GenerateServiceAccountToken - Access token for a service account, issued
+// by the client credentials grant
+func GenerateServiceAccountToken(serviceAccountID uint, clientID, role, scope string, permissions []string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ServiceAccountTokenLifetime)
+	claims := Claims{
+		Role:             role,
+		Permissions:      permissions,
+		ServiceAccountID: serviceAccountID,
+		ClientID:         clientID,
+		Scope:            scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        NewTokenID(),
 			Subject:   "access",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token, err := Keys().Sign(claims)
+	return token, expiresAt, err
 }
 
-// GenerateRefreshToken - Generate refresh token with 7 days expiry
-func GenerateRefreshToken(userID uint, email, role string) (string, error) {
+// ActorID - User ID of the impersonating actor, 0 for normal tokens
+func (c *Claims) ActorID() uint {
+	if c.Act == nil {
+		return 0
+	}
+	id, err := strconv.ParseUint(c.Act.Subject, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+// GenerateMFAToken - Generate short-lived MFA challenge token (5 minutes) issued
+// after the password step, exchanged for real tokens once the second factor is verified
+func GenerateMFAToken(userID uint, email string) (string, error) {
 	claims := Claims{
 		UserID: userID,
 		Email:  email,
-		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "refresh",
+			Subject:   "mfa",
+			ID:        NewTokenID(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return Keys().Sign(claims)
 }
 
-// GenerateResetToken - Generate password reset token with 1 hour expiry
-func GenerateResetToken(userID uint, email string) (string, error) {
+// GenerateEmailVerificationToken - Generate email verification token with 24 hour expiry
+func GenerateEmailVerificationToken(userID uint, email string) (string, error) {
 	claims := Claims{
 		UserID: userID,
 		Email:  email,
-		Role:   "reset",
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "reset",
+			Subject:   "verify_email",
+			ID:        NewTokenID(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return Keys().Sign(claims)
 }
 
 // ValidateJWT - Validate any JWT token
 func ValidateJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, Keys().Keyfunc)
 
 	if err != nil || !token.Valid {
 		return nil, err
@@ -103,28 +203,28 @@ func ValidateAccessToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-// ValidateRefreshToken - Specifically validate refresh tokens
-func ValidateRefreshToken(tokenString string) (*Claims, error) {
+// ValidateMFAToken - Specifically validate MFA challenge tokens
+func ValidateMFAToken(tokenString string) (*Claims, error) {
 	claims, err := ValidateJWT(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims.Subject != "refresh" {
+	if claims.Subject != "mfa" {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
 
 	return claims, nil
 }
 
-// ValidateResetToken - Specifically validate reset tokens
-func ValidateResetToken(tokenString string) (*Claims, error) {
+// ValidateEmailVerificationToken - Specifically validate email verification tokens
+func ValidateEmailVerificationToken(tokenString string) (*Claims, error) {
 	claims, err := ValidateJWT(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims.Subject != "reset" {
+	if claims.Subject != "verify_email" {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
 
@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type KeyStatus string
+
+const (
+	// KeyActive - Key used to sign new tokens
+	KeyActive KeyStatus = "active"
+	// KeyRetiring - Key only used to verify tokens signed before rotation
+	KeyRetiring KeyStatus = "retiring"
+)
+
+// LegacyKeyID - kid for the HS256 JWT_SECRET key. Tokens without a kid header
+// were signed by this key.
+const LegacyKeyID = "default"
+
+var (
+	ErrKeyNotFound    = errors.New("signing key not found")
+	ErrNoActiveKey    = errors.New("no active signing key")
+	ErrKeyCannotSign  = errors.New("signing key has no private part")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// SigningKey - One entry of the keyring, identified by kid
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // []byte for HMAC, private key otherwise (nil for verify-only keys)
+	VerifyKey interface{} // []byte for HMAC, public key otherwise
+	Status    KeyStatus
+}
+
+// Keyring - Set of signing keys, one of them active
+type Keyring struct {
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	activeID string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*SigningKey)}
+}
+
+// Add - Add key to keyring. Adding an active key makes it the signing key.
+func (k *Keyring) Add(key *SigningKey) error {
+	if key.ID == "" {
+		return errors.New("signing key requires a kid")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[key.ID] = key
+	if key.Status == KeyActive {
+		return k.setActive(key.ID)
+	}
+	return nil
+}
+
+// SetActive - Promote a key to active; the previous active key starts retiring
+func (k *Keyring) SetActive(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.setActive(kid)
+}
+
+func (k *Keyring) setActive(kid string) error {
+	key, ok := k.keys[kid]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if key.SignKey == nil {
+		return ErrKeyCannotSign
+	}
+
+	if previous, ok := k.keys[k.activeID]; ok && k.activeID != kid {
+		previous.Status = KeyRetiring
+	}
+	key.Status = KeyActive
+	k.activeID = kid
+	return nil
+}
+
+// Remove - Drop a retired key; tokens signed by it stop validating
+func (k *Keyring) Remove(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if kid == k.activeID {
+		return errors.New("cannot remove the active signing key")
+	}
+	delete(k.keys, kid)
+	return nil
+}
+
+// Active - Return the key used for signing
+func (k *Keyring) Active() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[k.activeID]
+	if !ok {
+		return nil, ErrNoActiveKey
+	}
+	return key, nil
+}
+
+// Get - Return key by kid
+func (k *Keyring) Get(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Sign - Sign claims with the active key and set the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key, err := k.Active()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// Keyfunc - jwt.Keyfunc resolving the verification key from the kid header
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := k.Get(kid)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	// Prevent algorithm confusion, e.g. an HS256 token signed with a public key
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+
+	return key.VerifyKey, nil
+}
+
+// JWK - Public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS - Public keys of every asymmetric key. HMAC secrets are never published.
+func (k *Keyring) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func publicJWK(key *SigningKey) (JWK, error) {
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch pub := key.VerifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return jwk, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		point := ecdh.Bytes() // uncompressed: 0x04 || X || Y
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return jwk, ErrUnsupportedKey
+	}
+
+	return jwk, nil
+}
+
+// NewHMACKey - Symmetric HS256 key
+func NewHMACKey(kid string, secret []byte, status KeyStatus) *SigningKey {
+	return &SigningKey{
+		ID:        kid,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+		Status:    status,
+	}
+}
+
+// NewAsymmetricKey - Build key from a private or public key, picking the
+// algorithm from the key type (RS256, ES256/ES384, EdDSA)
+func NewAsymmetricKey(kid string, key interface{}, status KeyStatus) (*SigningKey, error) {
+	signingKey := &SigningKey{ID: kid, Status: status}
+
+	if signer, ok := key.(crypto.Signer); ok {
+		signingKey.SignKey = signer
+		key = signer.Public()
+	}
+	signingKey.VerifyKey = key
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		signingKey.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			signingKey.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			signingKey.Method = jwt.SigningMethodES384
+		default:
+			return nil, ErrUnsupportedKey
+		}
+	case ed25519.PublicKey:
+		signingKey.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	return signingKey, nil
+}
+
+// LoadSigningKeyFromPEM - Load a private key (PKCS#8, PKCS#1 or SEC 1) or a
+// public key (PKIX, verification only) from a PEM file
+func LoadSigningKeyFromPEM(kid, path string, status KeyStatus) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return NewAsymmetricKey(kid, key, status)
+}
+
+// LoadKeyringFromEnv - Build keyring from environment:
+//
+//	JWT_KEYS       comma separated kid=path.pem entries
+//	JWT_ACTIVE_KID kid used for signing (defaults to the first entry)
+//	JWT_SECRET     legacy HS256 secret, kept for tokens without kid
+func LoadKeyringFromEnv() (*Keyring, error) {
+	keyring := NewKeyring()
+
+	secret := os.Getenv("JWT_SECRET")
+	keySpecs := strings.TrimSpace(os.Getenv("JWT_KEYS"))
+
+	if keySpecs == "" {
+		if secret == "" {
+			log.Println("WARNING: JWT_SECRET and JWT_KEYS not set, using insecure default secret")
+			secret = "your-default-secret-key" // Change this in production
+		}
+		return keyring, keyring.Add(NewHMACKey(LegacyKeyID, []byte(secret), KeyActive))
+	}
+
+	if secret != "" {
+		if err := keyring.Add(NewHMACKey(LegacyKeyID, []byte(secret), KeyRetiring)); err != nil {
+			return nil, err
+		}
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KID")
+	for _, spec := range strings.Split(keySpecs, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid=path", spec)
+		}
+
+		key, err := LoadSigningKeyFromPEM(kid, path, KeyRetiring)
+		if err != nil {
+			return nil, err
+		}
+		if err := keyring.Add(key); err != nil {
+			return nil, err
+		}
+		if activeID == "" {
+			activeID = kid
+		}
+	}
+
+	if err := keyring.SetActive(activeID); err != nil {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %q: %w", activeID, err)
+	}
+	return keyring, nil
+}
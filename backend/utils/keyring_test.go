@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "42",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func mustAsymmetricKey(t *testing.T, kid string, key interface{}, status KeyStatus) *SigningKey {
+	t.Helper()
+	signingKey, err := NewAsymmetricKey(kid, key, status)
+	if err != nil {
+		t.Fatalf("NewAsymmetricKey(%s): %v", kid, err)
+	}
+	return signingKey
+}
+
+func TestNewAsymmetricKeyPicksAlgorithm(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		key     interface{}
+		wantAlg string
+		wantErr error
+		canSign bool
+	}{
+		{name: "RSA private", key: rsaKey, wantAlg: "RS256", canSign: true},
+		{name: "RSA public", key: &rsaKey.PublicKey, wantAlg: "RS256"},
+		{name: "P-256 private", key: p256, wantAlg: "ES256", canSign: true},
+		{name: "P-384 private", key: p384, wantAlg: "ES384", canSign: true},
+		{name: "P-521 unsupported", key: p521, wantErr: ErrUnsupportedKey},
+		{name: "Ed25519 private", key: edKey, wantAlg: "EdDSA", canSign: true},
+		{name: "Ed25519 public", key: edKey.Public(), wantAlg: "EdDSA"},
+		{name: "HMAC secret", key: []byte("secret"), wantErr: ErrUnsupportedKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := NewAsymmetricKey("kid", tt.key, KeyRetiring)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if alg := key.Method.Alg(); alg != tt.wantAlg {
+				t.Errorf("got alg %s, want %s", alg, tt.wantAlg)
+			}
+			if canSign := key.SignKey != nil; canSign != tt.canSign {
+				t.Errorf("got canSign %v, want %v", canSign, tt.canSign)
+			}
+		})
+	}
+}
+
+func TestKeyringSignAndVerify(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name   string
+		active *SigningKey
+	}{
+		{name: "HMAC", active: NewHMACKey(LegacyKeyID, []byte("secret"), KeyActive)},
+		{name: "ES256", active: mustAsymmetricKey(t, "ec-1", ecKey, KeyActive)},
+		{name: "EdDSA", active: mustAsymmetricKey(t, "ed-1", edKey, KeyActive)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := NewKeyring()
+			if err := keyring.Add(tt.active); err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := keyring.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, keyring.Keyfunc)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if kid := token.Header["kid"]; kid != tt.active.ID {
+				t.Errorf("got kid %v, want %s", kid, tt.active.ID)
+			}
+			if alg := token.Method.Alg(); alg != tt.active.Method.Alg() {
+				t.Errorf("got alg %s, want %s", alg, tt.active.Method.Alg())
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keyring := NewKeyring()
+	if err := keyring.Add(NewHMACKey(LegacyKeyID, []byte("secret"), KeyActive)); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := keyring.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keyring.Add(mustAsymmetricKey(t, "ec-1", ecKey, KeyRetiring)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive("ec-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if legacy, _ := keyring.Get(LegacyKeyID); legacy.Status != KeyRetiring {
+		t.Errorf("previous active key has status %s, want %s", legacy.Status, KeyRetiring)
+	}
+	if active, _ := keyring.Active(); active.ID != "ec-1" {
+		t.Errorf("active key is %s, want ec-1", active.ID)
+	}
+
+	newToken, err := keyring.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, signed := range []string{oldToken, newToken} {
+		if _, err := jwt.Parse(signed, keyring.Keyfunc); err != nil {
+			t.Errorf("token no longer verifies after rotation: %v", err)
+		}
+	}
+
+	if err := keyring.Remove("ec-1"); err == nil {
+		t.Error("removing the active key succeeded")
+	}
+	if err := keyring.Remove(LegacyKeyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(oldToken, keyring.Keyfunc); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("token of removed key: got %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestKeyringSetActiveRejects(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name string
+		kid  string
+		want error
+	}{
+		{name: "unknown kid", kid: "missing", want: ErrKeyNotFound},
+		{name: "verify-only key", kid: "rsa-public", want: ErrKeyCannotSign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := NewKeyring()
+			if err := keyring.Add(mustAsymmetricKey(t, "rsa-public", &rsaKey.PublicKey, KeyRetiring)); err != nil {
+				t.Fatal(err)
+			}
+			if err := keyring.SetActive(tt.kid); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if _, err := keyring.Sign(testClaims()); !errors.Is(err, ErrNoActiveKey) {
+				t.Errorf("Sign: got %v, want %v", err, ErrNoActiveKey)
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaSigning := mustAsymmetricKey(t, "rsa-1", rsaKey, KeyActive)
+
+	keyring := NewKeyring()
+	if err := keyring.Add(rsaSigning); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		want  error
+	}{
+		{
+			name: "unknown kid",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+				token.Header["kid"] = "rsa-2"
+				signed, _ := token.SignedString(rsaKey)
+				return signed
+			},
+			want: ErrKeyNotFound,
+		},
+		{
+			name: "no kid and no legacy key",
+			token: func() string {
+				signed, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims()).SignedString(rsaKey)
+				return signed
+			},
+			want: ErrKeyNotFound,
+		},
+		{
+			// HS256 token using the published RSA public key as HMAC secret
+			name: "algorithm confusion",
+			token: func() string {
+				jwk := keyring.JWKS().Keys[0]
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+				token.Header["kid"] = "rsa-1"
+				signed, _ := token.SignedString([]byte(jwk.N))
+				return signed
+			},
+			want: jwt.ErrTokenSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwt.Parse(tt.token(), keyring.Keyfunc); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	keyring := NewKeyring()
+	for _, key := range []*SigningKey{
+		NewHMACKey(LegacyKeyID, []byte("secret"), KeyRetiring),
+		mustAsymmetricKey(t, "rsa-1", rsaKey, KeyActive),
+		mustAsymmetricKey(t, "ec-1", ecKey, KeyRetiring),
+		mustAsymmetricKey(t, "ed-1", edPublic, KeyRetiring),
+	} {
+		if err := keyring.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set := keyring.JWKS()
+
+	tests := []JWK{
+		{Kty: "EC", Kid: "ec-1", Use: "sig", Alg: "ES256", Crv: "P-256"},
+		{Kty: "OKP", Kid: "ed-1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519"},
+		{Kty: "RSA", Kid: "rsa-1", Use: "sig", Alg: "RS256", E: "AQAB"},
+	}
+	if len(set.Keys) != len(tests) {
+		t.Fatalf("got %d keys, want %d (HMAC secret must not be published)", len(set.Keys), len(tests))
+	}
+
+	for i, want := range tests {
+		t.Run(want.Kid, func(t *testing.T) {
+			got := set.Keys[i]
+			if got.Kid != want.Kid || got.Kty != want.Kty || got.Use != want.Use || got.Alg != want.Alg || got.Crv != want.Crv {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+			if want.E != "" && got.E != want.E {
+				t.Errorf("got e %s, want %s", got.E, want.E)
+			}
+
+			switch got.Kty {
+			case "RSA":
+				if got.N == "" || got.X != "" {
+					t.Errorf("unexpected RSA members %+v", got)
+				}
+			case "EC":
+				// P-256 coordinates are 32 bytes, 43 base64url characters
+				if len(got.X) != 43 || len(got.Y) != 43 {
+					t.Errorf("got coordinate lengths %d/%d, want 43", len(got.X), len(got.Y))
+				}
+			case "OKP":
+				if len(got.X) != 43 || got.Y != "" {
+					t.Errorf("unexpected OKP members %+v", got)
+				}
+			}
+		})
+	}
+}
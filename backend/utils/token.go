@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken - Generate random URL-safe token (not a JWT)
+func GenerateOpaqueToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PersonalAccessTokenPrefix - Marks personal access tokens, so that they can be
+// told apart from JWTs and found by secret scanners
+const PersonalAccessTokenPrefix = "pat_"
+
+// GeneratePersonalAccessToken - Random opaque token with PersonalAccessTokenPrefix
+func GeneratePersonalAccessToken() string {
+	return PersonalAccessTokenPrefix + GenerateOpaqueToken()
+}
+
+// Service account credentials. Client IDs are public, secrets carry their own
+// prefix for secret scanners.
+const (
+	ServiceAccountClientIDPrefix = "svc_"
+	ServiceAccountSecretPrefix   = "sas_"
+)
+
+// GenerateClientID - Random public client ID of a service account
+func GenerateClientID() string {
+	return ServiceAccountClientIDPrefix + NewTokenID()
+}
+
+// GenerateServiceAccountSecret - Random client secret with ServiceAccountSecretPrefix
+func GenerateServiceAccountSecret() string {
+	return ServiceAccountSecretPrefix + GenerateOpaqueToken()
+}
+
+// HashToken - SHA-256 hash of an opaque token for storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
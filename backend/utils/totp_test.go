@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// SHA1 test vectors, truncated to the 6 digits used here
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.want {
+				t.Errorf("got %s, want %s", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	codeAt := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: rfc6238Secret, code: codeAt(step), wantStep: step, wantOK: true},
+		{name: "previous step", secret: rfc6238Secret, code: codeAt(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step", secret: rfc6238Secret, code: codeAt(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "outside skew", secret: rfc6238Secret, code: codeAt(step - 2)},
+		{name: "wrong code", secret: rfc6238Secret, code: "000000"},
+		{name: "too short", secret: rfc6238Secret, code: codeAt(step)[:5]},
+		{name: "too long", secret: rfc6238Secret, code: codeAt(step) + "0"},
+		{name: "invalid secret", secret: "not base32!", code: "123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("got (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 20 {
+		t.Errorf("got %d byte secret, want 20", len(key))
+	}
+	if secret == GenerateTOTPSecret() {
+		t.Error("two generated secrets are equal")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Acme Inc", "jane@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("got %s://%s, want otpauth://totp", uri.Scheme, uri.Host)
+	}
+	if label := strings.TrimPrefix(uri.Path, "/"); label != "Acme Inc:jane@example.com" {
+		t.Errorf("got label %q", label)
+	}
+
+	query := uri.Query()
+	for param, want := range map[string]string{
+		"secret":    rfc6238Secret,
+		"issuer":    "Acme Inc",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s: got %q, want %q", param, got, want)
+		}
+	}
+}
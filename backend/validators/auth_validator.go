@@ -11,7 +11,9 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
-	RoleID   uint   `json:"role_id"` // opsional
+	RoleID   uint   `json:"role_id"` // opsional, hanya role dari REGISTRATION_ALLOWED_ROLES
+	// InvitationToken - Token dari email undangan admin, menentukan role
+	InvitationToken string `json:"invitation_token"`
 }
 
 // Login request struct
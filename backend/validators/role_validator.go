@@ -0,0 +1,20 @@
+package validators
+
+import (
+	"regexp"
+)
+
+var (
+	roleNamePattern       = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+	permissionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*:[a-z][a-z0-9_-]*$`)
+)
+
+// ValidateRoleName - Lowercase letters, digits, "_" and "-", 2 to 50 characters
+func ValidateRoleName(name string) bool {
+	return roleNamePattern.MatchString(name)
+}
+
+// ValidatePermissionName - "resource:action", e.g. "users:write"
+func ValidatePermissionName(name string) bool {
+	return len(name) <= 100 && permissionNamePattern.MatchString(name)
+}
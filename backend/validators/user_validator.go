@@ -1,7 +1,14 @@
 package validators
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
 	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
 )
 
 func ValidateEmail(email string) bool {
@@ -9,3 +16,159 @@ func ValidateEmail(email string) bool {
 	matched, _ := regexp.MatchString(pattern, email)
 	return matched
 }
+
+// userFields - JSON fields of models.User. Fields that exist but are not
+// updatable by the caller are reported as forbidden, anything else as unknown.
+var userFields = []string{
+	"id", "created_at", "updated_at", "deleted_at", "name", "email", "password",
+	"role_id", "role", "email_verified_at", "status", "status_reason", "status_changed_at",
+	"status_expires_at", "mfa_enabled", "totp_secret", "totp_last_step",
+}
+
+// UpdateProfileRequest - Fields a user may change on their own profile.
+// CurrentPassword is required to change the password.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name"`
+	Password        *string `json:"password"`
+	CurrentPassword *string `json:"current_password"`
+}
+
+// UpdateUserRequest - Fields an admin may change on any user
+type UpdateUserRequest struct {
+	Name     *string `json:"name"`
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	RoleID   *uint   `json:"role_id"`
+}
+
+// Validasi update profile (JSON Merge Patch)
+func ValidateUpdateProfileRequest(c *gin.Context) (UpdateProfileRequest, bool) {
+	var req UpdateProfileRequest
+	if !decodeMergePatch(c, &req, "name", "password", "current_password") {
+		return req, false
+	}
+
+	errs := map[string]string{}
+	validateName(req.Name, errs)
+	validateNewPassword(req.Password, errs)
+	if req.Password != nil && (req.CurrentPassword == nil || *req.CurrentPassword == "") {
+		errs["current_password"] = "is required to change the password"
+	}
+	return req, respondFieldErrors(c, errs)
+}
+
+// Validasi update user oleh admin (JSON Merge Patch)
+func ValidateUpdateUserRequest(c *gin.Context) (UpdateUserRequest, bool) {
+	var req UpdateUserRequest
+	if !decodeMergePatch(c, &req, "name", "email", "password", "role_id") {
+		return req, false
+	}
+
+	errs := map[string]string{}
+	validateName(req.Name, errs)
+	validateNewPassword(req.Password, errs)
+	if req.Email != nil {
+		*req.Email = strings.TrimSpace(*req.Email)
+		if !ValidateEmail(*req.Email) {
+			errs["email"] = "must be a valid email address"
+		}
+	}
+	if req.RoleID != nil && *req.RoleID == 0 {
+		errs["role_id"] = "must be a valid role ID"
+	}
+	return req, respondFieldErrors(c, errs)
+}
+
+// decodeMergePatch - Decode a JSON Merge Patch (RFC 7396) object into dst.
+// Members missing from the patch stay unchanged. Unknown and forbidden members
+// and null for fields that cannot be removed are rejected with 400.
+func decodeMergePatch(c *gin.Context, dst interface{}, allowed ...string) bool {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return false
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a JSON object"})
+		return false
+	}
+
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, field := range allowed {
+		allowedSet[field] = true
+	}
+	knownSet := make(map[string]bool, len(userFields))
+	for _, field := range userFields {
+		knownSet[field] = true
+	}
+
+	var unknown, forbidden, nulls []string
+	for field, value := range patch {
+		switch {
+		case !knownSet[field] && !allowedSet[field]:
+			unknown = append(unknown, field)
+		case !allowedSet[field]:
+			forbidden = append(forbidden, field)
+		case bytes.Equal(bytes.TrimSpace(value), []byte("null")):
+			// Removing a member is not possible for any user field
+			nulls = append(nulls, field)
+		}
+	}
+
+	if len(unknown) > 0 || len(forbidden) > 0 {
+		sort.Strings(unknown)
+		sort.Strings(forbidden)
+		response := gin.H{"error": "Request contains fields that cannot be updated", "allowed_fields": allowed}
+		if len(unknown) > 0 {
+			response["unknown_fields"] = unknown
+		}
+		if len(forbidden) > 0 {
+			response["forbidden_fields"] = forbidden
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return false
+	}
+
+	errs := map[string]string{}
+	for _, field := range nulls {
+		errs[field] = "cannot be null"
+	}
+	if !respondFieldErrors(c, errs) {
+		return false
+	}
+
+	if err := json.Unmarshal(body, dst); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field type", "details": err.Error()})
+		return false
+	}
+	return true
+}
+
+func validateName(name *string, errs map[string]string) {
+	if name == nil {
+		return
+	}
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		errs["name"] = "must not be empty"
+	} else if len(*name) > 100 {
+		errs["name"] = "must be at most 100 characters"
+	}
+}
+
+func validateNewPassword(password *string, errs map[string]string) {
+	if password != nil && !ValidatePassword(*password) {
+		errs["password"] = "must be at least 8 characters with uppercase, lowercase, and number"
+	}
+}
+
+// respondFieldErrors - 400 with per-field messages, true when there are none
+func respondFieldErrors(c *gin.Context, errs map[string]string) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": errs})
+	return false
+}
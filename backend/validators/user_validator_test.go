@@ -0,0 +1,226 @@
+package validators
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// patchContext - gin context for a PATCH request with the given JSON body
+func patchContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/merge-patch+json")
+	return c, w
+}
+
+// errorResponse - Decoded 400 body, nil when nothing was written
+func errorResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	if w.Body.Len() == 0 {
+		return nil
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateUpdateProfileRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     UpdateProfileRequest
+		wantResp map[string]interface{} // subset of the error response
+	}{
+		{
+			name: "empty patch",
+			body: `{}`,
+		},
+		{
+			name: "name is trimmed",
+			body: `{"name": "  Jane  "}`,
+			want: UpdateProfileRequest{Name: strPtr("Jane")},
+		},
+		{
+			name: "password change with current password",
+			body: `{"password": "NewPassw0rd", "current_password": "OldPassw0rd"}`,
+			want: UpdateProfileRequest{Password: strPtr("NewPassw0rd"), CurrentPassword: strPtr("OldPassw0rd")},
+		},
+		{
+			name:     "password change without current password",
+			body:     `{"password": "NewPassw0rd"}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"current_password": "is required to change the password"}},
+		},
+		{
+			name:     "password change with empty current password",
+			body:     `{"password": "NewPassw0rd", "current_password": ""}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"current_password": "is required to change the password"}},
+		},
+		{
+			name: "weak password",
+			body: `{"password": "short", "current_password": "OldPassw0rd"}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{
+				"password": "must be at least 8 characters with uppercase, lowercase, and number",
+			}},
+		},
+		{
+			name:     "empty name",
+			body:     `{"name": "   "}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"name": "must not be empty"}},
+		},
+		{
+			name:     "too long name",
+			body:     `{"name": "` + strings.Repeat("x", 101) + `"}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"name": "must be at most 100 characters"}},
+		},
+		{
+			name: "forbidden and unknown fields",
+			body: `{"name": "Jane", "role_id": 1, "email": "jane@example.com", "nickname": "J", "admin": true}`,
+			wantResp: map[string]interface{}{
+				"error":            "Request contains fields that cannot be updated",
+				"forbidden_fields": []interface{}{"email", "role_id"},
+				"unknown_fields":   []interface{}{"admin", "nickname"},
+				"allowed_fields":   []interface{}{"name", "password", "current_password"},
+			},
+		},
+		{
+			name:     "null field",
+			body:     `{"name": null}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"name": "cannot be null"}},
+		},
+		{
+			name:     "wrong type",
+			body:     `{"name": 42}`,
+			wantResp: map[string]interface{}{"error": "Invalid field type"},
+		},
+		{
+			name:     "not an object",
+			body:     `["name"]`,
+			wantResp: map[string]interface{}{"error": "Request body must be a JSON object"},
+		},
+		{
+			name:     "null body",
+			body:     `null`,
+			wantResp: map[string]interface{}{"error": "Request body must be a JSON object"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := patchContext(tt.body)
+			req, ok := ValidateUpdateProfileRequest(c)
+
+			response := errorResponse(t, w)
+			if ok != (tt.wantResp == nil) {
+				t.Fatalf("got ok %v, response %v", ok, response)
+			}
+			if ok {
+				if !reflect.DeepEqual(req, tt.want) {
+					t.Errorf("got %+v, want %+v", req, tt.want)
+				}
+				return
+			}
+			for key, want := range tt.wantResp {
+				if got := response[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUpdateUserRequest(t *testing.T) {
+	roleID := uint(3)
+
+	tests := []struct {
+		name     string
+		body     string
+		want     UpdateUserRequest
+		wantResp map[string]interface{}
+	}{
+		{
+			name: "all allowed fields",
+			body: `{"name": "Jane", "email": " jane@example.com ", "password": "NewPassw0rd", "role_id": 3}`,
+			want: UpdateUserRequest{
+				Name:     strPtr("Jane"),
+				Email:    strPtr("jane@example.com"),
+				Password: strPtr("NewPassw0rd"),
+				RoleID:   &roleID,
+			},
+		},
+		{
+			// Admins set passwords without knowing the current one
+			name: "password without current password",
+			body: `{"password": "NewPassw0rd"}`,
+			want: UpdateUserRequest{Password: strPtr("NewPassw0rd")},
+		},
+		{
+			name:     "invalid email",
+			body:     `{"email": "jane"}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"email": "must be a valid email address"}},
+		},
+		{
+			name:     "zero role ID",
+			body:     `{"role_id": 0}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"role_id": "must be a valid role ID"}},
+		},
+		{
+			name: "forbidden fields",
+			body: `{"status": "active", "mfa_enabled": false, "totp_secret": "x", "current_password": "x"}`,
+			wantResp: map[string]interface{}{
+				"forbidden_fields": []interface{}{"mfa_enabled", "status", "totp_secret"},
+				"unknown_fields":   []interface{}{"current_password"},
+			},
+		},
+		{
+			name:     "null role",
+			body:     `{"role_id": null}`,
+			wantResp: map[string]interface{}{"fields": map[string]interface{}{"role_id": "cannot be null"}},
+		},
+		{
+			name:     "negative role ID",
+			body:     `{"role_id": -1}`,
+			wantResp: map[string]interface{}{"error": "Invalid field type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := patchContext(tt.body)
+			req, ok := ValidateUpdateUserRequest(c)
+
+			response := errorResponse(t, w)
+			if ok != (tt.wantResp == nil) {
+				t.Fatalf("got ok %v, response %v", ok, response)
+			}
+			if ok {
+				if !reflect.DeepEqual(req, tt.want) {
+					t.Errorf("got %+v, want %+v", req, tt.want)
+				}
+				return
+			}
+			for key, want := range tt.wantResp {
+				if got := response[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Minimal CBOR (RFC 8949) decoder, enough for attestation objects and COSE keys.
+// Decoded values are uint64, int64, []byte, string, []interface{},
+// map[interface{}]interface{}, bool, nil or float64.
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+const cborMaxDepth = 16
+
+// decodeCBOR - Decode the first item of data, returning it and the bytes consumed
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := cborDecoder{data: data}
+	v, err := d.decode(0)
+	return v, d.pos, err
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errCBORTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// header - Read major type and argument
+func (d *cborDecoder) header() (byte, uint64, byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+
+	switch {
+	case info < 24:
+		return major, uint64(info), info, nil
+	case info == 24:
+		v, err := d.next(1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, uint64(v[0]), info, nil
+	case info == 25:
+		v, err := d.next(2)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint16(v)), info, nil
+	case info == 26:
+		v, err := d.next(4)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint32(v)), info, nil
+	case info == 27:
+		v, err := d.next(8)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return major, binary.BigEndian.Uint64(v), info, nil
+	default:
+		return 0, 0, 0, errors.New("cbor: indefinite length items are not supported")
+	}
+}
+
+func (d *cborDecoder) length(arg uint64) (int, error) {
+	if arg > uint64(len(d.data)-d.pos) {
+		return 0, errCBORTruncated
+	}
+	return int(arg), nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+
+	major, arg, info, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		return arg, nil
+	case 1: // negative integer
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3: // byte string, text string
+		n, err := d.length(arg)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case 4: // array
+		n, err := d.length(arg)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case 5: // map
+		n, err := d.length(arg)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case uint64, int64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key type")
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 6: // tag, ignored
+		return d.decode(depth + 1)
+	default: // simple values and floats
+		switch {
+		case info == 20:
+			return false, nil
+		case info == 21:
+			return true, nil
+		case info == 22, info == 23:
+			return nil, nil
+		case info == 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case info == 27:
+			return math.Float64frombits(arg), nil
+		default:
+			return nil, errors.New("cbor: unsupported simple value")
+		}
+	}
+}
+
+// cborInt - Read integer map value regardless of sign encoding
+func cborInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// cborLookup - Look up a map entry by integer key (COSE labels)
+func cborLookup(m map[interface{}]interface{}, key int64) (interface{}, bool) {
+	if key >= 0 {
+		v, ok := m[uint64(key)]
+		return v, ok
+	}
+	v, ok := m[key]
+	return v, ok
+}
@@ -0,0 +1,485 @@
+// Package webauthn implements the relying party side of WebAuthn (passkey)
+// registration and authentication ceremonies with "none" attestation.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagBackupEligible     = 0x08
+	flagAttestedCredential = 0x40
+	flagExtensionData      = 0x80
+)
+
+var (
+	ErrChallengeExpired  = errors.New("webauthn: ceremony expired")
+	ErrChallengeMismatch = errors.New("webauthn: challenge mismatch")
+	ErrOriginNotAllowed  = errors.New("webauthn: origin not allowed")
+	ErrRPIDMismatch      = errors.New("webauthn: relying party ID mismatch")
+	ErrUserNotPresent    = errors.New("webauthn: user presence required")
+	ErrUserNotVerified   = errors.New("webauthn: user verification required")
+	ErrInvalidSignature  = errors.New("webauthn: invalid signature")
+	ErrCredentialNotSent = errors.New("webauthn: credential not allowed")
+	ErrCloneDetected     = errors.New("webauthn: signature counter did not increase, authenticator may be cloned")
+	ErrMalformed         = errors.New("webauthn: malformed response")
+)
+
+// URLEncodedBytes - []byte serialized as unpadded base64url, as used by
+// PublicKeyCredential.toJSON()
+type URLEncodedBytes []byte
+
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Config - Relying party settings
+type Config struct {
+	RPID             string
+	RPName           string
+	Origins          []string
+	Timeout          time.Duration
+	UserVerification string // "required", "preferred" or "discouraged"
+}
+
+// ConfigFromEnv - WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME, WEBAUTHN_ORIGINS (comma separated)
+func ConfigFromEnv() Config {
+	cfg := Config{
+		RPID:             os.Getenv("WEBAUTHN_RP_ID"),
+		RPName:           os.Getenv("WEBAUTHN_RP_NAME"),
+		Timeout:          5 * time.Minute,
+		UserVerification: "preferred",
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = "localhost"
+	}
+	if cfg.RPName == "" {
+		cfg.RPName = "Golang Auth"
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.Origins = append(cfg.Origins, origin)
+		}
+	}
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{"http://localhost:3000"}
+	}
+	return cfg
+}
+
+type WebAuthn struct {
+	Config Config
+}
+
+func New(cfg Config) *WebAuthn {
+	return &WebAuthn{Config: cfg}
+}
+
+// User - Account a credential is registered for. ID is the opaque user handle.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential - Registered public key credential
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+}
+
+// SessionData - Server-side ceremony state, kept until the response arrives
+type SessionData struct {
+	Challenge          []byte
+	UserID             []byte
+	AllowedCredentials [][]byte
+	UserVerification   string
+	Expires            time.Time
+}
+
+type RelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CredentialCreationOptions - JSON form of PublicKeyCredentialCreationOptions
+type CredentialCreationOptions struct {
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions - JSON form of PublicKeyCredentialRequestOptions
+type CredentialRequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse - JSON form of a PublicKeyCredential from navigator.credentials.create()
+type RegistrationResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AttestationObject URLEncodedBytes `json:"attestationObject"`
+		Transports        []string        `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse - JSON form of a PublicKeyCredential from navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+		Signature         URLEncodedBytes `json:"signature"`
+		UserHandle        URLEncodedBytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func newChallenge() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return list
+}
+
+// BeginRegistration - Options for navigator.credentials.create(); exclude lists
+// credentials the user already has so the same authenticator is not registered twice
+func (w *WebAuthn) BeginRegistration(user User, exclude [][]byte) (*CredentialCreationOptions, *SessionData) {
+	challenge := newChallenge()
+
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	options := &CredentialCreationOptions{
+		Challenge:          challenge,
+		RP:                 RelyingParty{ID: w.Config.RPID, Name: w.Config.RPName},
+		User:               UserEntity{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName},
+		PubKeyCredParams:   params,
+		Timeout:            w.Config.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		// Passwordless login is discoverable only, see BeginLogin
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   w.Config.UserVerification,
+		},
+		Attestation: "none",
+	}
+
+	session := &SessionData{
+		Challenge:        challenge,
+		UserID:           user.ID,
+		UserVerification: w.Config.UserVerification,
+		Expires:          time.Now().Add(w.Config.Timeout),
+	}
+	return options, session
+}
+
+// FinishRegistration - Verify the attestation response and return the new credential.
+// Attestation statements are not checked against a trust store ("none" conveyance).
+func (w *WebAuthn) FinishRegistration(session *SessionData, resp *RegistrationResponse) (*Credential, error) {
+	if err := w.verifyClientData(session, resp.Response.ClientDataJSON, "webauthn.create"); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrMalformed
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAuthenticatorData(session, authData); err != nil {
+		return nil, err
+	}
+	if authData.Flags&flagAttestedCredential == 0 {
+		return nil, ErrMalformed
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, authData.CredentialID) {
+		return nil, ErrMalformed
+	}
+
+	if _, err := ParsePublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             authData.CredentialID,
+		PublicKey:      authData.PublicKey,
+		SignCount:      authData.SignCount,
+		AAGUID:         authData.AAGUID,
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.Flags&flagBackupEligible != 0,
+	}, nil
+}
+
+// BeginLogin - Options for navigator.credentials.get(). Empty allowed list means
+// discoverable credentials (the authenticator picks the account).
+func (w *WebAuthn) BeginLogin(allowed [][]byte) (*CredentialRequestOptions, *SessionData) {
+	challenge := newChallenge()
+
+	options := &CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          w.Config.Timeout.Milliseconds(),
+		RPID:             w.Config.RPID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: w.Config.UserVerification,
+	}
+
+	session := &SessionData{
+		Challenge:          challenge,
+		AllowedCredentials: allowed,
+		UserVerification:   w.Config.UserVerification,
+		Expires:            time.Now().Add(w.Config.Timeout),
+	}
+	return options, session
+}
+
+// Assertion - Outcome of a verified assertion
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool // the authenticator checked a PIN or biometric, not only presence
+}
+
+// FinishLogin - Verify an assertion made with credential
+func (w *WebAuthn) FinishLogin(session *SessionData, resp *AssertionResponse, credential *Credential) (*Assertion, error) {
+	if !bytes.Equal(resp.RawID, credential.ID) {
+		return nil, ErrCredentialNotSent
+	}
+	if len(session.AllowedCredentials) > 0 {
+		allowed := false
+		for _, id := range session.AllowedCredentials {
+			if bytes.Equal(id, credential.ID) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrCredentialNotSent
+		}
+	}
+
+	if err := w.verifyClientData(session, resp.Response.ClientDataJSON, "webauthn.get"); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAuthenticatorData(session, authData); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := ParsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !publicKey.Verify(signed, resp.Response.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Authenticators that do not implement counters always report 0
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return nil, ErrCloneDetected
+	}
+
+	return &Assertion{
+		SignCount:    authData.SignCount,
+		UserVerified: authData.Flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (w *WebAuthn) verifyClientData(session *SessionData, raw []byte, ceremony string) error {
+	if time.Now().After(session.Expires) {
+		return ErrChallengeExpired
+	}
+
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return ErrMalformed
+	}
+	if data.Type != ceremony {
+		return ErrMalformed
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(challenge, session.Challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	if data.CrossOrigin {
+		return ErrOriginNotAllowed
+	}
+	for _, origin := range w.Config.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginNotAllowed
+}
+
+func (w *WebAuthn) verifyAuthenticatorData(session *SessionData, data *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(w.Config.RPID))
+	if !bytes.Equal(data.RPIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if data.Flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if session.UserVerification == "required" && data.Flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrMalformed
+	}
+
+	data := &authenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if data.Flags&flagAttestedCredential != 0 {
+		if len(rest) < 18 {
+			return nil, ErrMalformed
+		}
+		data.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, ErrMalformed
+		}
+		data.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		data.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if data.Flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+	return data, nil
+}
@@ -0,0 +1,454 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func testRP() *WebAuthn {
+	return New(Config{
+		RPID:             testRPID,
+		RPName:           "Test",
+		Origins:          []string{testOrigin},
+		Timeout:          time.Minute,
+		UserVerification: "preferred",
+	})
+}
+
+// Minimal CBOR encoder for building authenticator output
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt64(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, uint64(len(s))), s...) }
+
+// cborMap - Map from already encoded key/value pairs
+func cborMap(pairs ...[]byte) []byte {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, p := range pairs {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// softAuthenticator - ES256 authenticator holding one credential
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{
+		key:          key,
+		credentialID: id,
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return cborMap(
+		cborInt64(coseKty), cborInt64(ktyEC2),
+		cborInt64(coseAlg), cborInt64(AlgES256),
+		cborInt64(coseCrv), cborInt64(crvP256),
+		cborInt64(coseX), cborBytes(x),
+		cborInt64(coseY), cborBytes(y),
+	)
+}
+
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	raw, _ := json.Marshal(clientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return raw
+}
+
+func (a *softAuthenticator) create(options *CredentialCreationOptions) *RegistrationResponse {
+	authData := a.authData(a.flags|flagAttestedCredential, true)
+	resp := &RegistrationResponse{ID: base64.RawURLEncoding.EncodeToString(a.credentialID), RawID: a.credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	resp.Response.AttestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+	return resp
+}
+
+func (a *softAuthenticator) get(options *CredentialRequestOptions) *AssertionResponse {
+	a.signCount++
+	authData := a.authData(a.flags, false)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	resp := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(a.credentialID), RawID: a.credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = clientDataJSON
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = signature
+	return resp
+}
+
+// register - Run a registration ceremony and return the stored credential
+func register(t *testing.T, rp *WebAuthn, a *softAuthenticator) *Credential {
+	t.Helper()
+	options, session := rp.BeginRegistration(User{ID: []byte("1"), Name: "user@example.com"}, nil)
+	credential, err := rp.FinishRegistration(session, a.create(options))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return credential
+}
+
+func TestRegistrationAndLoginRoundTrip(t *testing.T) {
+	rp := testRP()
+	a := newSoftAuthenticator(t)
+
+	credential := register(t, rp, a)
+	if string(credential.ID) != string(a.credentialID) {
+		t.Fatalf("credential ID = %x, want %x", credential.ID, a.credentialID)
+	}
+
+	for i := 0; i < 2; i++ {
+		options, session := rp.BeginLogin([][]byte{credential.ID})
+		assertion, err := rp.FinishLogin(session, a.get(options), credential)
+		if err != nil {
+			t.Fatalf("FinishLogin #%d: %v", i+1, err)
+		}
+		if assertion.SignCount != a.signCount {
+			t.Errorf("sign count = %d, want %d", assertion.SignCount, a.signCount)
+		}
+		if !assertion.UserVerified {
+			t.Error("user verification flag was not reported")
+		}
+		credential.SignCount = assertion.SignCount
+	}
+}
+
+func TestFinishLoginRejects(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticator func(*softAuthenticator) // before the assertion is made
+		response      func(*AssertionResponse) // after the assertion is made
+		session       func(*SessionData)
+		want          error
+	}{
+		{
+			name:     "bad signature",
+			response: func(r *AssertionResponse) { r.Response.Signature[len(r.Response.Signature)-1] ^= 0xff },
+			want:     ErrInvalidSignature,
+		},
+		{
+			name: "signed by another key",
+			response: func(r *AssertionResponse) {
+				other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				clientDataHash := sha256.Sum256(r.Response.ClientDataJSON)
+				digest := sha256.Sum256(append(append([]byte(nil), r.Response.AuthenticatorData...), clientDataHash[:]...))
+				r.Response.Signature, _ = ecdsa.SignASN1(rand.Reader, other, digest[:])
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name:          "sign count regression",
+			authenticator: func(a *softAuthenticator) { a.signCount = 0 },
+			want:          ErrCloneDetected,
+		},
+		{
+			name:          "wrong RP ID hash",
+			authenticator: func(a *softAuthenticator) { a.rpID = "evil.example" },
+			want:          ErrRPIDMismatch,
+		},
+		{
+			name:          "wrong origin",
+			authenticator: func(a *softAuthenticator) { a.origin = "https://evil.example" },
+			want:          ErrOriginNotAllowed,
+		},
+		{
+			name:    "challenge mismatch",
+			session: func(s *SessionData) { s.Challenge = newChallenge() },
+			want:    ErrChallengeMismatch,
+		},
+		{
+			name:    "expired ceremony",
+			session: func(s *SessionData) { s.Expires = time.Now().Add(-time.Second) },
+			want:    ErrChallengeExpired,
+		},
+		{
+			name:          "user verification required",
+			authenticator: func(a *softAuthenticator) { a.flags = flagUserPresent },
+			session:       func(s *SessionData) { s.UserVerification = "required" },
+			want:          ErrUserNotVerified,
+		},
+		{
+			name:          "user not present",
+			authenticator: func(a *softAuthenticator) { a.flags = 0 },
+			want:          ErrUserNotPresent,
+		},
+		{
+			name:     "credential not allowed",
+			response: func(r *AssertionResponse) { r.RawID = []byte("other credential") },
+			want:     ErrCredentialNotSent,
+		},
+		{
+			name:     "malformed authenticator data",
+			response: func(r *AssertionResponse) { r.Response.AuthenticatorData = r.Response.AuthenticatorData[:36] },
+			want:     ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			a := newSoftAuthenticator(t)
+			credential := register(t, rp, a)
+
+			// One successful login so that the stored counter is above zero
+			options, session := rp.BeginLogin([][]byte{credential.ID})
+			assertion, err := rp.FinishLogin(session, a.get(options), credential)
+			if err != nil {
+				t.Fatalf("first login: %v", err)
+			}
+			credential.SignCount = assertion.SignCount
+
+			options, session = rp.BeginLogin([][]byte{credential.ID})
+			if tt.session != nil {
+				tt.session(session)
+			}
+			if tt.authenticator != nil {
+				tt.authenticator(a)
+			}
+			resp := a.get(options)
+			if tt.response != nil {
+				tt.response(resp)
+			}
+
+			if _, err := rp.FinishLogin(session, resp, credential); !errors.Is(err, tt.want) {
+				t.Fatalf("FinishLogin error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinishLoginReportsMissingUserVerification(t *testing.T) {
+	rp := testRP()
+	a := newSoftAuthenticator(t)
+	credential := register(t, rp, a)
+
+	a.flags = flagUserPresent
+	options, session := rp.BeginLogin(nil)
+	assertion, err := rp.FinishLogin(session, a.get(options), credential)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if assertion.UserVerified {
+		t.Error("UserVerified = true for an assertion without the UV flag")
+	}
+}
+
+func TestFinishRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*softAuthenticator, *RegistrationResponse)
+		want   error
+	}{
+		{
+			name: "truncated attestation object",
+			tamper: func(_ *softAuthenticator, r *RegistrationResponse) {
+				r.Response.AttestationObject = r.Response.AttestationObject[:len(r.Response.AttestationObject)/2]
+			},
+			want: ErrMalformed,
+		},
+		{
+			name:   "attestation object is not a map",
+			tamper: func(_ *softAuthenticator, r *RegistrationResponse) { r.Response.AttestationObject = cborText("none") },
+			want:   ErrMalformed,
+		},
+		{
+			name: "indefinite length map",
+			tamper: func(_ *softAuthenticator, r *RegistrationResponse) {
+				r.Response.AttestationObject = []byte{0xbf, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0xff}
+			},
+			want: ErrMalformed,
+		},
+		{
+			name: "missing authData",
+			tamper: func(_ *softAuthenticator, r *RegistrationResponse) {
+				r.Response.AttestationObject = cborMap(cborText("fmt"), cborText("none"))
+			},
+			want: ErrMalformed,
+		},
+		{
+			name: "authData with trailing bytes",
+			tamper: func(a *softAuthenticator, r *RegistrationResponse) {
+				authData := append(a.authData(a.flags|flagAttestedCredential, true), 0x00)
+				r.Response.AttestationObject = cborMap(cborText("fmt"), cborText("none"), cborText("authData"), cborBytes(authData))
+			},
+			want: ErrMalformed,
+		},
+		{
+			name: "authData without attested credential",
+			tamper: func(a *softAuthenticator, r *RegistrationResponse) {
+				r.Response.AttestationObject = cborMap(cborText("fmt"), cborText("none"), cborText("authData"), cborBytes(a.authData(a.flags, false)))
+			},
+			want: ErrMalformed,
+		},
+		{
+			name:   "wrong RP ID hash",
+			tamper: func(a *softAuthenticator, r *RegistrationResponse) { *r = *a.createWithRPID("evil.example", r) },
+			want:   ErrRPIDMismatch,
+		},
+		{
+			name: "client data for a login",
+			tamper: func(a *softAuthenticator, r *RegistrationResponse) {
+				r.Response.ClientDataJSON = a.clientData("webauthn.get", nil)
+			},
+			want: ErrMalformed,
+		},
+		{
+			name:   "raw ID differs from attested credential",
+			tamper: func(_ *softAuthenticator, r *RegistrationResponse) { r.RawID = []byte("other credential") },
+			want:   ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			a := newSoftAuthenticator(t)
+			options, session := rp.BeginRegistration(User{ID: []byte("1"), Name: "user@example.com"}, nil)
+			resp := a.create(options)
+			tt.tamper(a, resp)
+
+			if _, err := rp.FinishRegistration(session, resp); !errors.Is(err, tt.want) {
+				t.Fatalf("FinishRegistration error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// createWithRPID - Same registration response, authenticator data scoped to rpID
+func (a *softAuthenticator) createWithRPID(rpID string, resp *RegistrationResponse) *RegistrationResponse {
+	saved := a.rpID
+	a.rpID = rpID
+	defer func() { a.rpID = saved }()
+
+	out := *resp
+	out.Response.AttestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(a.flags|flagAttestedCredential, true)),
+	)
+	return &out
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "small unsigned", data: []byte{0x17}, want: uint64(23)},
+		{name: "one byte unsigned", data: []byte{0x18, 0xff}, want: uint64(255)},
+		{name: "negative", data: []byte{0x38, 0x63}, want: int64(-100)},
+		{name: "text", data: cborText("none"), want: "none"},
+		{name: "true", data: []byte{0xf5}, want: true},
+		{name: "empty", data: nil, wantErr: true},
+		{name: "truncated argument", data: []byte{0x19, 0x01}, wantErr: true},
+		{name: "length beyond data", data: []byte{0x5a, 0xff, 0xff, 0xff, 0xff, 0x00}, wantErr: true},
+		{name: "indefinite length", data: []byte{0x5f, 0x41, 0x00, 0xff}, wantErr: true},
+		{name: "map with byte string key", data: []byte{0xa1, 0x41, 0x00, 0x00}, wantErr: true},
+		{name: "nesting too deep", data: append(bytesOf(0x81, cborMaxDepth+2), 0x00), wantErr: true},
+		{name: "integer overflow", data: []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := decodeCBOR(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeCBOR(%x) = %v, want error", tt.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCBOR(%x): %v", tt.data, err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeCBOR(%x) = %#v, want %#v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func bytesOf(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}